@@ -8,6 +8,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -37,6 +38,9 @@ type Chef struct {
 	UserId       string
 	SSLNoVerify  bool
 	Organization string
+	// EncryptedDataBagSecretPath is the encrypted_data_bag_secret setting of
+	// the knife.rb used to connect, if any
+	EncryptedDataBagSecretPath string
 }
 
 // Connect looks for knife/chef configuration files and gather connection info
@@ -96,6 +100,8 @@ func Connect(filename ...string) (*Chef, error) {
 					return nil, err
 				}
 				chef.Key = key
+			case "encrypted_data_bag_secret":
+				chef.EncryptedDataBagSecretPath = filterQuotes(split[1])
 			case "chef_server_url":
 				parsedUrl := filterQuotes(split[1])
 				chef.Url = parsedUrl
@@ -277,8 +283,15 @@ func (chef *Chef) Post(endpoint string, contentType string, params map[string]st
 // Put makes an authenticated PUT request to the Chef server for the supplied
 // endpoint
 func (chef *Chef) Put(endpoint string, params map[string]string, body io.Reader) (*http.Response, error) {
-	//TODO: Finish this
-	request, _ := http.NewRequest("PUT", chef.requestUrl(endpoint), body)
+	query, err := chef.buildQueryString(endpoint, params)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest("PUT", query, body)
+	if err != nil {
+		return nil, err
+	}
 	request.Header.Set("Content-Type", "application/json")
 	return chef.makeRequest(request)
 }
@@ -286,11 +299,29 @@ func (chef *Chef) Put(endpoint string, params map[string]string, body io.Reader)
 // Delete makes an authenticated DELETE request to the Chef server for the
 // supplied endpoint
 func (chef *Chef) Delete(endpoint string, params map[string]string) (*http.Response, error) {
-	//TODO: Finish this
-	request, _ := http.NewRequest("DELETE", chef.requestUrl(endpoint), nil)
+	query, err := chef.buildQueryString(endpoint, params)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest("DELETE", query, nil)
+	if err != nil {
+		return nil, err
+	}
 	return chef.makeRequest(request)
 }
 
+// server returns a copy of the connection whose requests go to the root of
+// the Chef server instead of the organization, for the endpoints which aren't
+// organization specific, such as users
+func (chef *Chef) server() *Chef {
+	server := *chef
+	if chef.Organization != "" {
+		server.Url = strings.TrimSuffix(chef.Url, "/organizations/"+chef.Organization)
+	}
+	return &server
+}
+
 //
 // requestUrl generate the requestUrl from supplied endpoint and params
 //
@@ -532,12 +563,40 @@ func (chef *Chef) apiRequestHeaders(request *http.Request) error {
 	return nil
 }
 
-// Given an http response object, responseBody returns the response body
+// chef.ResponseError is returned when the server answers a request with an
+// unsuccessful status. Message is the server's error message, if it sent one.
+type ResponseError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s: %s", e.Status, e.Message)
+	}
+	return e.Status
+}
+
+// hasStatus returns whether an error is the server answering with the given
+// status code
+func hasStatus(err error, code int) bool {
+	var respErr *ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == code
+}
+
+// Given an http response object, responseBody returns the response body, or
+// an error carrying the server's error message if the request wasn't successful
 func responseBody(resp *http.Response) ([]byte, error) {
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New(resp.Status)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, &ResponseError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Message:    chefErrorMessage(body, ""),
+		}
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -547,3 +606,33 @@ func responseBody(resp *http.Response) ([]byte, error) {
 
 	return body, nil
 }
+
+// chefErrorMessage extracts the error message(s) from the JSON body the Chef
+// server sends along with a failed request, falling back to the given status
+func chefErrorMessage(body []byte, status string) string {
+	var payload struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || len(payload.Error) == 0 {
+		return status
+	}
+
+	var message string
+	if err := json.Unmarshal(payload.Error, &message); err == nil {
+		return message
+	}
+	var messages []string
+	if err := json.Unmarshal(payload.Error, &messages); err == nil {
+		return strings.Join(messages, "; ")
+	}
+	var detailed []struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(payload.Error, &detailed); err == nil {
+		for _, d := range detailed {
+			messages = append(messages, d.Message)
+		}
+		return strings.Join(messages, "; ")
+	}
+	return string(payload.Error)
+}
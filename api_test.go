@@ -2,6 +2,7 @@ package chef
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -396,3 +397,48 @@ func TestFilterQuotes(t *testing.T) {
 		}
 	}
 }
+
+func TestResponseBodyStatus(t *testing.T) {
+	response := func(code int, status, body string) *http.Response {
+		return &http.Response{StatusCode: code, Status: status, Body: ioutil.NopCloser(strings.NewReader(body))}
+	}
+
+	body, err := responseBody(response(201, "201 Created", `{"uri": "https://chef/environments/staging"}`))
+	if err != nil || !strings.Contains(string(body), "staging") {
+		t.Errorf("a 201 response should be successful, got %s, %v", body, err)
+	}
+
+	_, err = responseBody(response(409, "409 Conflict", `{"error": ["Environment already exists"]}`))
+	if err == nil || err.Error() != "409 Conflict: Environment already exists" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	_, err = responseBody(response(502, "502 Bad Gateway", "<html>Bad Gateway</html>"))
+	if err == nil || err.Error() != "502 Bad Gateway" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestResponseErrorStatus(t *testing.T) {
+	response := func(code int, status, body string) *http.Response {
+		return &http.Response{StatusCode: code, Status: status, Body: ioutil.NopCloser(strings.NewReader(body))}
+	}
+
+	_, err := responseBody(response(404, "404 Not Found", `{"error": ["Cannot load node web1"]}`))
+	if !hasStatus(err, http.StatusNotFound) {
+		t.Errorf("a 404 response should be not found, got %v", err)
+	}
+
+	// a failure whose message mentions 404 must not pass for not found
+	_, err = responseBody(response(500, "500 Internal Server Error", `{"error": ["upstream answered 404"]}`))
+	if hasStatus(err, http.StatusNotFound) {
+		t.Errorf("a 500 response shouldn't be not found, got %v", err)
+	}
+	if !hasStatus(err, http.StatusInternalServerError) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if hasStatus(errors.New("404 Not Found"), http.StatusNotFound) {
+		t.Error("an error which isn't a response error shouldn't be not found")
+	}
+}
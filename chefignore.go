@@ -0,0 +1,192 @@
+package chef
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// chef.Chefignore holds the patterns of one or more chefignore files. A file
+// whose path, relative to the cookbook's root, matches any of the patterns is
+// left out of the cookbook, just like knife does.
+type Chefignore struct {
+	Patterns []string
+}
+
+// chef.ParseChefignore parses the content of a chefignore file. Blank lines
+// and lines starting with "#" are skipped, every other line is a pattern.
+func ParseChefignore(content []byte) *Chefignore {
+	ignore := new(Chefignore)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ignore.Patterns = append(ignore.Patterns, line)
+	}
+	return ignore
+}
+
+// chef.ReadChefignore reads and combines the patterns of the supplied
+// chefignore files. Files which don't exist are skipped.
+//
+// Usage:
+//
+//     ignore, err := chef.ReadChefignore("cookbooks/chefignore", "cookbooks/apache2/chefignore")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println(ignore.Ignored("recipes/.default.rb.swp"))
+func ReadChefignore(files ...string) (*Chefignore, error) {
+	ignore := new(Chefignore)
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ignore.Patterns = append(ignore.Patterns, ParseChefignore(content).Patterns...)
+	}
+	return ignore, nil
+}
+
+// chefignoreFile returns the chefignore file which applies to the cookbook in
+// the supplied directory, like knife: the cookbook's own if it has one,
+// otherwise the repository level one, found next to the cookbooks. It returns
+// an empty string if there is neither.
+func chefignoreFile(dir string) string {
+	dir = filepath.Clean(dir)
+	for _, file := range []string{
+		filepath.Join(dir, "chefignore"),
+		filepath.Join(filepath.Dir(dir), "chefignore"),
+	} {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file
+		}
+	}
+	return ""
+}
+
+// Ignored returns true if the supplied path, relative to the cookbook's root
+// and using forward slashes, matches any of the patterns
+func (ignore *Chefignore) Ignored(path string) bool {
+	if ignore == nil {
+		return false
+	}
+	for _, pattern := range ignore.Patterns {
+		if fnmatch(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// fnmatch implements Ruby's File.fnmatch without any flags, which is what
+// chefignore patterns use: "*" and "?" also match "/", but no wildcard matches
+// a leading "." of the path. "[...]" classes and "\" escapes are supported.
+func fnmatch(pattern, name string) bool {
+	return fnmatchAt(pattern, name, 0)
+}
+
+func fnmatchAt(pattern, name string, pos int) bool {
+	for len(pattern) > 0 {
+		leadingDot := pos == 0 && len(name) > 0 && name[0] == '.'
+		switch pattern[0] {
+		case '*':
+			if leadingDot {
+				return false
+			}
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if fnmatchAt(pattern, name[i:], pos+i) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 || leadingDot {
+				return false
+			}
+		case '[':
+			if len(name) == 0 || leadingDot {
+				return false
+			}
+			matched, rest, ok := matchClass(pattern[1:], name[0])
+			if !ok {
+				// an unterminated class is matched literally
+				if name[0] != '[' {
+					return false
+				}
+				break
+			}
+			if !matched {
+				return false
+			}
+			pattern = rest
+			name = name[1:]
+			pos++
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(name) == 0 || pattern[0] != name[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+		pos++
+	}
+	return len(name) == 0
+}
+
+// matchClass matches a character against a "[...]" class, whose content
+// starts at the beginning of pattern. It returns whether the character
+// matched, the rest of the pattern after the class, and false if the class
+// isn't terminated.
+func matchClass(pattern string, c byte) (bool, string, bool) {
+	negate := false
+	if len(pattern) > 0 && (pattern[0] == '!' || pattern[0] == '^') {
+		negate = true
+		pattern = pattern[1:]
+	}
+	matched := false
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == ']' && i > 0 {
+			return matched != negate, pattern[i+1:], true
+		}
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+		hi := lo
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			if hi == '\\' && i+3 < len(pattern) {
+				i++
+				hi = pattern[i+2]
+			}
+			i += 2
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+	return false, "", false
+}
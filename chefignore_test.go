@@ -0,0 +1,107 @@
+package chef
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFnmatch(t *testing.T) {
+	known := []struct {
+		pattern string
+		path    string
+		ok      bool
+	}{
+		{"*~", "recipes/default.rb~", true},
+		{"*.sw[a-z]", "recipes/.default.rb.swp", true},
+		{"*.sw[a-z]", "recipes/default.rb.sw1", false},
+		{".#*", ".#metadata.rb", true},
+		{"*/.#*", "recipes/.#default.rb", true},
+		{"*", ".kitchen.yml", false},
+		{".*", ".kitchen.yml", true},
+		{"test/*", "test/integration/default/serverspec/default_spec.rb", true},
+		{"spec/*", "recipes/spec.rb", false},
+		{"\\#*#", "#default.rb#", true},
+		{"Gemfile", "Gemfile", true},
+		{"Gemfile", "Gemfile.lock", false},
+		{"*.[!r]b", "files/default/x.ab", true},
+		{"*.[!r]b", "recipes/x.rb", false},
+		{"?ecipes/*", "recipes/default.rb", true},
+	}
+	for _, k := range known {
+		if fnmatch(k.pattern, k.path) != k.ok {
+			t.Errorf("fnmatch(%q, %q) should be %v", k.pattern, k.path, k.ok)
+		}
+	}
+}
+
+func TestLoadCookbookVersionChefignore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chef-chefignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestCookbook(t, dir, map[string]string{
+		"chefignore":                          "# repository wide, overridden by the cookbook's own\nrecipes/*\n",
+		"app/chefignore":                      "test/*\n*.sw[a-z]\n*~\nREADME.md\n",
+		"app/metadata.rb":                     "name 'app'\nversion '1.0.0'\n",
+		"app/README.md":                       "# app\n",
+		"app/recipes/default.rb":              "package 'app'\n",
+		"app/recipes/default.rb~":             "package 'ap'\n",
+		"app/recipes/.default.rb.swp":         "swap",
+		"app/templates/default/app.conf.erb":  "port 80\n",
+		"app/templates/default/app.conf.erb~": "port 8\n",
+		"app/.git/config":                     "[core]\n",
+	})
+
+	cookbook, err := LoadCookbookVersion(filepath.Join(dir, "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, segment := range cookbookSegments {
+		for _, item := range cookbook.segmentItems(segment) {
+			paths = append(paths, item.Path)
+		}
+	}
+	expected := []string{"recipes/default.rb", "chefignore", "metadata.rb", "templates/default/app.conf.erb"}
+	if len(paths) != len(expected) {
+		t.Fatalf("unexpected cookbook files %v", paths)
+	}
+	for i := range paths {
+		if paths[i] != expected[i] {
+			t.Errorf("unexpected cookbook files %v", paths)
+		}
+	}
+}
+
+func TestChefignoreFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chef-chefignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestCookbook(t, dir, map[string]string{
+		"chefignore":             "*~\n",
+		"app/chefignore":         "README.md\n",
+		"app/metadata.rb":        "name 'app'\nversion '1.0.0'\n",
+		"db/metadata.rb":         "name 'db'\nversion '1.0.0'\n",
+		"db/recipes/default.rb~": "package 'd'\n",
+	})
+
+	// the cookbook's own chefignore is used instead of the repository's
+	if file := chefignoreFile(filepath.Join(dir, "app")); file != filepath.Join(dir, "app", "chefignore") {
+		t.Errorf("unexpected chefignore %s", file)
+	}
+	// without one, the repository's is used
+	if file := chefignoreFile(filepath.Join(dir, "db")); file != filepath.Join(dir, "chefignore") {
+		t.Errorf("unexpected chefignore %s", file)
+	}
+	// and without either, none is
+	if file := chefignoreFile(filepath.Join(dir, "db", "recipes")); file != "" {
+		t.Errorf("unexpected chefignore %s", file)
+	}
+}
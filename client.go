@@ -1,9 +1,12 @@
 package chef
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"net/http"
+	"regexp"
+	"time"
 )
 
 // chef.Client defines the relevant parameters of a Chef client. This includes
@@ -80,7 +83,7 @@ func (chef *Chef) GetClient(name string) (*Client, bool, error) {
 	}
 	body, err := responseBody(resp)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
+		if hasStatus(err, http.StatusNotFound) {
 			return nil, false, nil
 		}
 		return nil, false, err
@@ -91,3 +94,268 @@ func (chef *Chef) GetClient(name string) (*Client, bool, error) {
 
 	return client, true, nil
 }
+
+// clientNameRegexp matches the client names the Chef server accepts
+var clientNameRegexp = regexp.MustCompile(`^[\.\-[:alnum:]_]+$`)
+
+// chef.ClientCredentials holds the keys of a client returned when it's created
+// or reregistered. PrivateKey is only set when the server generated the key
+// pair, and the server doesn't keep it: it must be saved right away.
+type ClientCredentials struct {
+	Name       string
+	URI        string
+	PublicKey  string
+	PrivateKey string
+}
+
+// parseClientCredentials decodes the keys returned by the server, either at
+// the top level or, with newer API versions, in a chef_key object
+func parseClientCredentials(name string, body []byte) (*ClientCredentials, error) {
+	var response struct {
+		URI        string `json:"uri"`
+		PublicKey  string `json:"public_key"`
+		PrivateKey string `json:"private_key"`
+		ChefKey    struct {
+			PublicKey  string `json:"public_key"`
+			PrivateKey string `json:"private_key"`
+		} `json:"chef_key"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	credentials := &ClientCredentials{
+		Name:       name,
+		URI:        response.URI,
+		PublicKey:  response.PublicKey,
+		PrivateKey: response.PrivateKey,
+	}
+	if response.ChefKey.PublicKey != "" {
+		credentials.PublicKey = response.ChefKey.PublicKey
+	}
+	if response.ChefKey.PrivateKey != "" {
+		credentials.PrivateKey = response.ChefKey.PrivateKey
+	}
+	return credentials, nil
+}
+
+// clientFields returns the fields of a client the server accepts when
+// creating or updating it
+func clientFields(client *Client) (map[string]interface{}, error) {
+	if !clientNameRegexp.MatchString(client.Name) {
+		return nil, fmt.Errorf("invalid client name '%s'", client.Name)
+	}
+	return map[string]interface{}{
+		"name":       client.Name,
+		"clientname": client.Name,
+		"admin":      client.Admin,
+		"validator":  client.Validator,
+		"json_class": "Chef::ApiClient",
+		"chef_type":  "client",
+	}, nil
+}
+
+// chef.CreateClient creates a new client on the server from the supplied
+// *chef.Client type. If the client has a PublicKey, that key is registered for
+// it, otherwise the server generates a key pair and the returned credentials
+// hold its private key.
+//
+// Usage:
+//
+//     credentials, err := chef.CreateClient(&chef.Client{Name: "web1.example.com"})
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     ioutil.WriteFile("client.pem", []byte(credentials.PrivateKey), 0600)
+func (chef *Chef) CreateClient(client *Client) (*ClientCredentials, error) {
+	fields, err := clientFields(client)
+	if err != nil {
+		return nil, err
+	}
+	if client.PublicKey != "" {
+		fields["public_key"] = client.PublicKey
+	} else {
+		fields["create_key"] = true
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chef.Post("clients", "application/json", nil, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := parseClientCredentials(client.Name, body)
+	if err != nil {
+		return nil, err
+	}
+	if credentials.PublicKey == "" {
+		credentials.PublicKey = client.PublicKey
+	}
+	return credentials, nil
+}
+
+// chef.UpdateClient reads the client with the given name, hands it to the
+// supplied function to be modified, and writes the result back to the server.
+// The name, admin and validator flags can be changed this way, use
+// chef.ReregisterClient to change the client's key. The updated client is
+// returned. If the function returns an error, nothing is written.
+//
+// Usage:
+//
+//     client, err := chef.UpdateClient("web1.example.com", func(client *chef.Client) error {
+//         client.Validator = false
+//         return nil
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) UpdateClient(name string, update func(*Client) error) (*Client, error) {
+	client, ok, err := chef.GetClient(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("client %s not found", name)
+	}
+	if err := update(client); err != nil {
+		return nil, err
+	}
+
+	fields, err := clientFields(client)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chef.Put(fmt.Sprintf("clients/%s", name), nil, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := responseBody(resp); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// chef.DeleteClient deletes the client with the given name from the server.
+//
+// Usage:
+//
+//     err := chef.DeleteClient("web1.example.com")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) DeleteClient(name string) error {
+	resp, err := chef.Delete(fmt.Sprintf("clients/%s", name), nil)
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// chef.ReregisterClient has the server generate a new key pair for the client
+// with the given name, like knife client reregister. The client's "default"
+// key is replaced through the keys endpoint, other keys are left alone. The
+// old key stops working immediately, and the returned credentials hold the new
+// private key. Servers without the keys endpoint have the client's key
+// replaced the way API version 0 does it.
+//
+// The new key is added before the old one is deleted. If replacing the old key
+// fails once the new one exists, the credentials are returned along with the
+// error, which tells the names of the client's keys.
+//
+// Usage:
+//
+//     credentials, err := chef.ReregisterClient("web1.example.com")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     ioutil.WriteFile("client.pem", []byte(credentials.PrivateKey), 0600)
+func (chef *Chef) ReregisterClient(name string) (*ClientCredentials, error) {
+	endpoint := fmt.Sprintf("clients/%s/keys", name)
+	suffix := time.Now().UnixNano()
+	temporary := fmt.Sprintf("reregister-%d", suffix)
+	privateKey, err := chef.createKey(endpoint, &Key{Name: temporary, ExpirationDate: NeverExpires()})
+	if hasStatus(err, http.StatusNotFound) {
+		_, ok, err := chef.GetClient(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("client %s not found", name)
+		}
+		return chef.reregisterClientV0(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	credentials := &ClientCredentials{
+		Name:       name,
+		URI:        chef.requestUrl(fmt.Sprintf("clients/%s", name)),
+		PrivateKey: privateKey,
+	}
+
+	// the old default key is moved out of the way and deleted last, so the
+	// client always has a key whose private key is known
+	_, hasDefault, err := chef.getKey(endpoint, "default")
+	if err != nil {
+		return credentials, fmt.Errorf("the new key of client %s was added as %s, but its default key couldn't be read: %s", name, temporary, err)
+	}
+	replaced := fmt.Sprintf("replaced-%d", suffix)
+	if hasDefault {
+		if _, err := chef.updateKey(endpoint, "default", renameKey(replaced)); err != nil {
+			return credentials, fmt.Errorf("the new key of client %s was added as %s, but its default key couldn't be replaced: %s", name, temporary, err)
+		}
+	}
+	key, err := chef.updateKey(endpoint, temporary, renameKey("default"))
+	if err != nil {
+		if hasDefault {
+			chef.updateKey(endpoint, replaced, renameKey("default"))
+		}
+		return credentials, fmt.Errorf("the new key of client %s was added as %s, but couldn't be renamed to default: %s", name, temporary, err)
+	}
+	credentials.PublicKey = key.PublicKey
+	if hasDefault {
+		if err := chef.deleteKey(endpoint, replaced); err != nil {
+			return credentials, fmt.Errorf("the new default key of client %s was added, but its old key, renamed %s, couldn't be deleted: %s", name, replaced, err)
+		}
+	}
+	return credentials, nil
+}
+
+// renameKey returns a function for chef.updateKey giving a key a new name
+func renameKey(name string) func(*Key) error {
+	return func(key *Key) error {
+		key.Name = name
+		return nil
+	}
+}
+
+// reregisterClientV0 has the server replace the key of a client on servers
+// only supporting API version 0, which lack the keys endpoint
+func (chef *Chef) reregisterClientV0(name string) (*ClientCredentials, error) {
+	payload, err := json.Marshal(map[string]interface{}{"name": name, "private_key": true})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chef.Put(fmt.Sprintf("clients/%s", name), nil, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	return parseClientCredentials(name, body)
+}
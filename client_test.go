@@ -1,6 +1,7 @@
 package chef
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -27,3 +28,65 @@ func TestGetClient(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestParseClientCredentials(t *testing.T) {
+	v0 := `{"uri": "https://chef/clients/web1", "public_key": "PUBLIC", "private_key": "PRIVATE"}`
+	v1 := `{"uri": "https://chef/clients/web1", "chef_key": {"name": "default", "public_key": "PUBLIC", "private_key": "PRIVATE"}}`
+	for _, body := range []string{v0, v1} {
+		credentials, err := parseClientCredentials("web1", []byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := ClientCredentials{"web1", "https://chef/clients/web1", "PUBLIC", "PRIVATE"}
+		if *credentials != expected {
+			t.Errorf("unexpected credentials %v", credentials)
+		}
+	}
+}
+
+func TestClientCRUD(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	name := "chef_golang_test"
+
+	credentials, err := chef.CreateClient(&Client{Name: name, Validator: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chef.DeleteClient(name)
+	if !strings.Contains(credentials.PrivateKey, "PRIVATE KEY") {
+		t.Error("Creating a client should return its private key")
+	}
+
+	_, err = chef.UpdateClient(name, func(client *Client) error {
+		client.Validator = false
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, ok, err := chef.GetClient(name)
+	if err != nil || !ok {
+		t.Fatal("Couldn't find updated client", err)
+	}
+	if client.Validator {
+		t.Error("Client wasn't updated")
+	}
+
+	reregistered, err := chef.ReregisterClient(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reregistered.PrivateKey == "" || reregistered.PrivateKey == credentials.PrivateKey {
+		t.Error("Reregistering should return a new private key")
+	}
+	if keys, err := chef.GetClientKeys(name); err == nil && (len(keys) != 1 || keys[0].Name != "default") {
+		t.Errorf("Reregistering should replace the default key, got %v", keys)
+	}
+
+	if err := chef.DeleteClient(name); err != nil {
+		t.Error(err)
+	}
+	if _, ok, _ := chef.GetClient(name); ok {
+		t.Error("Client wasn't deleted")
+	}
+}
@@ -1,9 +1,14 @@
 package chef
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
 )
 
 // chef.Cookbook defines the relevant parameters of a Chef cookbook. This
@@ -12,13 +17,21 @@ import (
 // RESTful URL of the cookbook version and Version, which represents the version
 // number (identifier) of the cookbook version
 type Cookbook struct {
-	Url      string `json:"url"`
-	Versions []struct {
-		Url     string `json:"url"`
-		Version string `json:"version"`
-	} `json:"versions"`
+	Url      string               `json:"url"`
+	Versions []CookbookVersionRef `json:"versions"`
 }
 
+// chef.CookbookVersionRef points to a specific version of a cookbook: Url is the
+// RESTful URL of the cookbook version and Version is its version number.
+type CookbookVersionRef struct {
+	Url     string `json:"url"`
+	Version string `json:"version"`
+}
+
+// chef.AllVersions can be passed as the number of versions to the cookbook
+// listing methods to list every version of every cookbook
+const AllVersions = -1
+
 // chef.CookbookVersion defines the relevant parameters of a specific Chef
 // cookbook version. This includes, but is not limited to, information about
 // recipes, files, etc, various pieces of metadata about the cookbook at that
@@ -52,26 +65,35 @@ type CookbookVersion struct {
 	RootFiles []struct {
 		CookbookItem
 	} `json:"root_files"`
-	Metadata struct {
-		Name            string                 `json:"name"`
-		Description     string                 `json:"description"`
-		LongDescription string                 `json:"long_description"`
-		Maintainer      string                 `json:"maintainer"`
-		MaintainerEmail string                 `json:"maintainer_email"`
-		License         string                 `json:"license"`
-		Platforms       map[string]string      `json:"platforms"`
-		Dependencies    map[string]string      `json:"dependencies"`
-		Providing       map[string]string      `json:"providing"`
-		Attributes      map[string]interface{} `json:"attributes"`
-		Recipes         map[string]string      `json:"recipes"`
-		Version         string                 `json:"version"`
-	} `json:"metadata"`
-	Name      string `json:"cookbook_name"`
-	Version   string `json:"version"`
-	FullName  string `json:"name"`
-	Frozen    bool   `json:"frozen?"`
-	ChefType  string `json:"chef_type"`
-	JSONClass string `json:"json_class"`
+	Metadata  CookbookMetadata `json:"metadata"`
+	Name      string           `json:"cookbook_name"`
+	Version   string           `json:"version"`
+	FullName  string           `json:"name"`
+	Frozen    bool             `json:"frozen?"`
+	ChefType  string           `json:"chef_type"`
+	JSONClass string           `json:"json_class"`
+
+	// dir is the directory the cookbook version was loaded from, if it was
+	// loaded from disk with chef.LoadCookbookVersion
+	dir string
+}
+
+// chef.CookbookMetadata defines the metadata of a cookbook version, as found
+// in the cookbook's metadata.rb or metadata.json file: its name, version,
+// dependencies, supported platforms, etc.
+type CookbookMetadata struct {
+	Name            string                 `json:"name"`
+	Description     string                 `json:"description"`
+	LongDescription string                 `json:"long_description"`
+	Maintainer      string                 `json:"maintainer"`
+	MaintainerEmail string                 `json:"maintainer_email"`
+	License         string                 `json:"license"`
+	Platforms       map[string]string      `json:"platforms"`
+	Dependencies    map[string]string      `json:"dependencies"`
+	Providing       map[string]string      `json:"providing"`
+	Attributes      map[string]interface{} `json:"attributes"`
+	Recipes         map[string]string      `json:"recipes"`
+	Version         string                 `json:"version"`
 }
 
 // chef.CookbookItem defines the relevant parameters of various items that are
@@ -117,6 +139,127 @@ func (chef *Chef) GetCookbooks() (map[string]*Cookbook, error) {
 	return cookbooks, nil
 }
 
+// chef.GetCookbooksWithVersions is similar to chef.GetCookbooks, but lists up
+// to numVersions versions of each cookbook, newest first, instead of only the
+// latest one. Pass chef.AllVersions to list every version on the server.
+//
+// Usage:
+//
+//     cookbooks, err := chef.GetCookbooksWithVersions(chef.AllVersions)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for name, cookbook := range cookbooks {
+//         for _, version := range cookbook.Versions {
+//             fmt.Println(name, version.Version)
+//         }
+//     }
+func (chef *Chef) GetCookbooksWithVersions(numVersions int) (map[string]*Cookbook, error) {
+	return chef.getCookbookList("cookbooks", numVersions)
+}
+
+// getCookbookList fetches a cookbook listing endpoint with the num_versions
+// parameter set
+func (chef *Chef) getCookbookList(endpoint string, numVersions int) (map[string]*Cookbook, error) {
+	num := "all"
+	if numVersions != AllVersions {
+		if numVersions < 0 {
+			return nil, fmt.Errorf("invalid number of versions: %d", numVersions)
+		}
+		num = strconv.Itoa(numVersions)
+	}
+	resp, err := chef.GetWithParams(endpoint, map[string]string{"num_versions": num})
+	if err != nil {
+		return nil, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	cookbooks := map[string]*Cookbook{}
+	if err := json.Unmarshal(body, &cookbooks); err != nil {
+		return nil, err
+	}
+
+	return cookbooks, nil
+}
+
+// chef.GetLatestCookbooks returns a map of cookbook names to a
+// *chef.CookbookVersionRef type which points to the latest version of each
+// cookbook, as well as an error indicating if the request was successful or
+// not.
+//
+// Usage:
+//
+//     latest, err := chef.GetLatestCookbooks()
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for name, ref := range latest {
+//         fmt.Println(name, ref.Version)
+//     }
+func (chef *Chef) GetLatestCookbooks() (map[string]*CookbookVersionRef, error) {
+	resp, err := chef.Get("cookbooks/_latest")
+	if err != nil {
+		return nil, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := map[string]string{}
+	if err := json.Unmarshal(body, &urls); err != nil {
+		return nil, err
+	}
+
+	latest := map[string]*CookbookVersionRef{}
+	for name, url := range urls {
+		// the URL ends with the version, e.g. .../cookbooks/apache2/1.10.2
+		latest[name] = &CookbookVersionRef{
+			Url:     url,
+			Version: path.Base(url),
+		}
+	}
+
+	return latest, nil
+}
+
+// chef.GetCookbookRecipes returns a slice of the names of every recipe in the
+// latest version of every cookbook, such as "apache2" or "apache2::mod_ssl",
+// as well as an error indicating if the request was successful or not.
+//
+// Usage:
+//
+//     recipes, err := chef.GetCookbookRecipes()
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, recipe := range recipes {
+//         fmt.Println(recipe)
+//     }
+func (chef *Chef) GetCookbookRecipes() ([]string, error) {
+	resp, err := chef.Get("cookbooks/_recipes")
+	if err != nil {
+		return nil, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	recipes := []string{}
+	if err := json.Unmarshal(body, &recipes); err != nil {
+		return nil, err
+	}
+
+	return recipes, nil
+}
+
 // chef.GetCookbook returns a pointer to the chef.Cookbook type for a given
 // string that represents a cookbook name. It also returns a bool indicating
 // whether or not the client was found and an error indicating if the request
@@ -146,7 +289,7 @@ func (chef *Chef) GetCookbook(name string) (*Cookbook, bool, error) {
 	}
 	body, err := responseBody(resp)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
+		if hasStatus(err, http.StatusNotFound) {
 			return nil, false, nil
 		}
 		return nil, false, err
@@ -187,7 +330,7 @@ func (chef *Chef) GetCookbookVersion(name, version string) (*CookbookVersion, bo
 	}
 	body, err := responseBody(resp)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
+		if hasStatus(err, http.StatusNotFound) {
 			return nil, false, nil
 		}
 		return nil, false, err
@@ -196,3 +339,167 @@ func (chef *Chef) GetCookbookVersion(name, version string) (*CookbookVersion, bo
 	json.Unmarshal(body, &cookbook)
 	return cookbook, true, nil
 }
+
+// chef.GetCookbookItemContent returns the content of a file of a cookbook
+// version, such as a recipe or a template. If the cookbook version was loaded
+// from disk with chef.LoadCookbookVersion the file is read locally, otherwise
+// it is downloaded from the item's URL.
+//
+// Usage:
+//
+//     cookbook, _, _ := chef.GetCookbookVersion("apache", "1.0.0")
+//     for _, recipe := range cookbook.Recipes {
+//         content, err := chef.GetCookbookItemContent(cookbook, recipe.CookbookItem)
+//         if err != nil {
+//             fmt.Println(err)
+//             os.Exit(1)
+//         }
+//         fmt.Println(string(content))
+//     }
+func (chef *Chef) GetCookbookItemContent(cookbook *CookbookVersion, item CookbookItem) ([]byte, error) {
+	if cookbook.dir != "" {
+		return ioutil.ReadFile(filepath.Join(cookbook.dir, filepath.FromSlash(item.Path)))
+	}
+	if item.Url == "" {
+		return nil, fmt.Errorf("no URL for cookbook file %s", item.Path)
+	}
+
+	request, err := http.NewRequest("GET", item.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chef.makeRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	return responseBody(resp)
+}
+
+// chef.DeleteCookbookVersion deletes a specific version of a cookbook from
+// the server. The files of the cookbook version are left in the server's file
+// store; use chef.PurgeCookbookVersion to remove them as well.
+//
+// Usage:
+//
+//     err := chef.DeleteCookbookVersion("apache", "1.0.0")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) DeleteCookbookVersion(name, version string) error {
+	return chef.deleteCookbookVersion(name, version, nil)
+}
+
+// chef.PurgeCookbookVersion deletes a specific version of a cookbook from the
+// server along with every file of that version which isn't used by another
+// cookbook version.
+//
+// Usage:
+//
+//     err := chef.PurgeCookbookVersion("apache", "1.0.0")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) PurgeCookbookVersion(name, version string) error {
+	return chef.deleteCookbookVersion(name, version, map[string]string{"purge": "true"})
+}
+
+func (chef *Chef) deleteCookbookVersion(name, version string, params map[string]string) error {
+	resp, err := chef.Delete(fmt.Sprintf("cookbooks/%s/%s", name, version), params)
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// chef.FreezeCookbookVersion freezes a cookbook version which has already been
+// uploaded, so that it can no longer be overwritten without forcing it. The
+// cookbook version is read from the server, marked as frozen and written back
+// as is, so no information the server holds about it is lost.
+//
+// Usage:
+//
+//     err := chef.FreezeCookbookVersion("apache", "1.0.0")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) FreezeCookbookVersion(name, version string) error {
+	endpoint := fmt.Sprintf("cookbooks/%s/%s", name, version)
+	resp, err := chef.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return err
+	}
+
+	cookbook := map[string]interface{}{}
+	if err := json.Unmarshal(body, &cookbook); err != nil {
+		return err
+	}
+	if frozen, _ := cookbook["frozen?"].(bool); frozen {
+		return nil
+	}
+	cookbook["frozen?"] = true
+
+	payload, err := json.Marshal(cookbook)
+	if err != nil {
+		return err
+	}
+	resp, err = chef.Put(endpoint, nil, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// chef.UniverseEntry defines a single cookbook version as reported by the
+// /universe endpoint: where the cookbook can be downloaded from and what it
+// depends on.
+type UniverseEntry struct {
+	LocationType string            `json:"location_type"`
+	LocationPath string            `json:"location_path"`
+	DownloadUrl  string            `json:"download_url"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+// chef.GetUniverse returns the dependency information of every cookbook
+// version on the server as a map of cookbook names to a map of version numbers
+// to *chef.UniverseEntry types, as well as an error indicating if the request
+// was successful or not.
+//
+// Usage:
+//
+//     universe, err := chef.GetUniverse()
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     // do what you please with the "universe" variable
+//     for name, versions := range universe {
+//         for version, entry := range versions {
+//             fmt.Println(name, version, entry.Dependencies)
+//         }
+//     }
+func (chef *Chef) GetUniverse() (map[string]map[string]*UniverseEntry, error) {
+	resp, err := chef.Get("universe")
+	if err != nil {
+		return nil, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	universe := map[string]map[string]*UniverseEntry{}
+	if err := json.Unmarshal(body, &universe); err != nil {
+		return nil, err
+	}
+
+	return universe, nil
+}
@@ -46,3 +46,67 @@ func TestCookbookVersion(t *testing.T) {
 		t.Error("Cookbook version not found")
 	}
 }
+
+func TestGetUniverse(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	universe, err := chef.GetUniverse()
+	if err != nil {
+		t.Error(err)
+	}
+	if universe[config.RequiredCookbook.Name] == nil {
+		t.Error("Couldn't find required cookbook in universe")
+	}
+}
+
+func TestGetCookbooksWithVersions(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	cookbooks, err := chef.GetCookbooksWithVersions(AllVersions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookbook := cookbooks[config.RequiredCookbook.Name]
+	if cookbook == nil {
+		t.Fatal("Couldn't find required cookbook")
+	}
+	found := false
+	for _, version := range cookbook.Versions {
+		if version.Version == config.RequiredCookbook.Version {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Couldn't find required cookbook version")
+	}
+}
+
+func TestGetLatestCookbooks(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	latest, err := chef.GetLatestCookbooks()
+	if err != nil {
+		t.Error(err)
+	}
+	if latest[config.RequiredCookbook.Name] == nil {
+		t.Error("Couldn't find required cookbook")
+	}
+}
+
+func TestGetCookbookRecipes(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	recipes, err := chef.GetCookbookRecipes()
+	if err != nil {
+		t.Error(err)
+	}
+	found := false
+	for _, recipe := range recipes {
+		if recipe == config.RequiredRecipe.Name {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Couldn't find required recipe")
+	}
+}
@@ -0,0 +1,342 @@
+package chef
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// chef.CookbookGraph describes the dependencies between a set of cookbook
+// versions. Versions maps every cookbook of the set to its version and
+// Dependencies maps it to its dependencies and their version constraints, as
+// found in its metadata. Unsatisfied lists the dependencies which no cookbook
+// version available to the graph satisfies.
+type CookbookGraph struct {
+	Versions     map[string]string
+	Dependencies map[string]map[string]string
+	Unsatisfied  []UnsatisfiedDependency
+}
+
+// chef.UnsatisfiedDependency is a dependency of a cookbook version which none
+// of the Available versions of the dependency satisfies
+type UnsatisfiedDependency struct {
+	Cookbook   string
+	Version    string
+	Dependency string
+	Constraint string
+	Available  []string
+}
+
+// String returns the dependency in the "apache2 1.0.0 depends on iptables
+// ~> 2.0" form
+func (u UnsatisfiedDependency) String() string {
+	return fmt.Sprintf("%s %s depends on %s %s", u.Cookbook, u.Version, u.Dependency, u.Constraint)
+}
+
+// chef.NewCookbookGraph builds the graph of a set of cookbooks, usually the
+// cookbooks a node would run. Dependencies on cookbooks missing from the set,
+// or whose version in the set doesn't satisfy the constraint, are flagged as
+// unsatisfied.
+func NewCookbookGraph(cookbooks []*CookbookMetadata) (*CookbookGraph, error) {
+	available := map[string][]string{}
+	for _, cookbook := range cookbooks {
+		available[cookbook.Name] = []string{cookbook.Version}
+	}
+	return newCookbookGraph(cookbooks, available)
+}
+
+// newCookbookGraph builds the graph of a set of cookbooks, flagging the
+// dependencies which none of the available versions satisfies
+func newCookbookGraph(cookbooks []*CookbookMetadata, available map[string][]string) (*CookbookGraph, error) {
+	graph := &CookbookGraph{
+		Versions:     map[string]string{},
+		Dependencies: map[string]map[string]string{},
+		Unsatisfied:  []UnsatisfiedDependency{},
+	}
+	for _, cookbook := range cookbooks {
+		graph.Versions[cookbook.Name] = cookbook.Version
+		deps := map[string]string{}
+		for dep, constraint := range cookbook.Dependencies {
+			deps[dep] = constraint
+		}
+		graph.Dependencies[cookbook.Name] = deps
+	}
+
+	for _, name := range graph.names() {
+		for _, dep := range sortedKeys(graph.Dependencies[name]) {
+			constraint, err := ParseVersionConstraint(graph.Dependencies[name][dep])
+			if err != nil {
+				return nil, fmt.Errorf("cookbook %s dependency on %s: %s", name, dep, err)
+			}
+			if version, ok := graph.Versions[dep]; ok {
+				v, err := ParseVersion(version)
+				if err == nil && constraint.Satisfies(v) {
+					continue
+				}
+			}
+			versions := []string{}
+			for _, v := range sortVersionsDescending(available[dep]) {
+				versions = append(versions, v.String())
+			}
+			graph.Unsatisfied = append(graph.Unsatisfied, UnsatisfiedDependency{
+				Cookbook:   name,
+				Version:    graph.Versions[name],
+				Dependency: dep,
+				Constraint: graph.Dependencies[name][dep],
+				Available:  versions,
+			})
+		}
+	}
+	return graph, nil
+}
+
+// Graph builds the dependency graph of a cookbook version from the cookbook
+// versions the solver knows about. Each dependency is resolved to the newest
+// version satisfying the first constraint found on it, without backtracking,
+// so that the graph can be built even when the dependencies can't be solved.
+// Constraints that no known version satisfies, or that the picked version
+// doesn't satisfy, are flagged as unsatisfied.
+func (d *Depsolver) Graph(name, version string) (*CookbookGraph, error) {
+	v, err := ParseVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := d.Cookbooks[name][v.String()]; !ok {
+		return nil, fmt.Errorf("cookbook %s %s not found", name, version)
+	}
+
+	available := map[string][]string{}
+	for cookbook, versions := range d.Cookbooks {
+		for version := range versions {
+			available[cookbook] = append(available[cookbook], version)
+		}
+	}
+
+	picked := map[string]string{name: v.String()}
+	cookbooks := []*CookbookMetadata{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		deps := d.Cookbooks[current][picked[current]]
+		cookbooks = append(cookbooks, &CookbookMetadata{Name: current, Version: picked[current], Dependencies: deps})
+
+		for _, dep := range sortedKeys(deps) {
+			if _, ok := picked[dep]; ok {
+				continue
+			}
+			constraint, err := ParseVersionConstraint(deps[dep])
+			if err != nil {
+				return nil, fmt.Errorf("cookbook %s dependency on %s: %s", current, dep, err)
+			}
+			for _, candidate := range sortVersionsDescending(available[dep]) {
+				if constraint.Satisfies(candidate) {
+					picked[dep] = candidate.String()
+					queue = append(queue, dep)
+					break
+				}
+			}
+		}
+	}
+	return newCookbookGraph(cookbooks, available)
+}
+
+// chef.GetCookbookVersionGraph builds the dependency graph of a cookbook
+// version from the cookbook versions on the server, see Depsolver.Graph.
+//
+// Usage:
+//
+//     graph, err := chef.GetCookbookVersionGraph("apache2", "1.10.2")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, dep := range graph.Unsatisfied {
+//         fmt.Println(dep, "available:", dep.Available)
+//     }
+func (chef *Chef) GetCookbookVersionGraph(name, version string) (*CookbookGraph, error) {
+	solver, err := chef.NewDepsolverFromUniverse()
+	if err != nil {
+		return nil, err
+	}
+	return solver.Graph(name, version)
+}
+
+// chef.GetEnvironmentCookbookGraph builds the dependency graph of the cookbook
+// versions the server resolves for a run list in an environment, see
+// chef.SolveEnvironmentCookbooks.
+//
+// Usage:
+//
+//     graph, err := chef.GetEnvironmentCookbookGraph("production", []string{"recipe[apache2]"})
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println(graph.DOT())
+func (chef *Chef) GetEnvironmentCookbookGraph(env string, runList []string) (*CookbookGraph, error) {
+	solution, err := chef.SolveEnvironmentCookbooks(env, runList)
+	if err != nil {
+		return nil, err
+	}
+	cookbooks := []*CookbookMetadata{}
+	for name, cookbook := range solution {
+		metadata := cookbook.Metadata
+		metadata.Name = name
+		if metadata.Version == "" {
+			metadata.Version = cookbook.Version
+		}
+		cookbooks = append(cookbooks, &metadata)
+	}
+	return NewCookbookGraph(cookbooks)
+}
+
+// chef.LoadCookbookGraph builds the dependency graph of cookbooks on disk,
+// reading their metadata with chef.ReadCookbookMetadata.
+//
+// Usage:
+//
+//     dirs, _ := filepath.Glob("cookbooks/*")
+//     graph, err := chef.LoadCookbookGraph(dirs...)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, cycle := range graph.Cycles() {
+//         fmt.Println("cycle:", strings.Join(cycle, " -> "))
+//     }
+func LoadCookbookGraph(dirs ...string) (*CookbookGraph, error) {
+	cookbooks := []*CookbookMetadata{}
+	for _, dir := range dirs {
+		metadata, err := ReadCookbookMetadata(dir)
+		if err != nil {
+			return nil, err
+		}
+		cookbooks = append(cookbooks, metadata)
+	}
+	return NewCookbookGraph(cookbooks)
+}
+
+// names returns the sorted names of the cookbooks of the graph
+func (g *CookbookGraph) names() []string {
+	return sortedKeys(g.Versions)
+}
+
+// edges returns the dependencies between the cookbooks of the graph, leaving
+// out the dependencies on missing cookbooks
+func (g *CookbookGraph) edges() map[string][]string {
+	edges := map[string][]string{}
+	for name, deps := range g.Dependencies {
+		for _, dep := range sortedKeys(deps) {
+			if _, ok := g.Versions[dep]; ok {
+				edges[name] = append(edges[name], dep)
+			}
+		}
+	}
+	return edges
+}
+
+// Cycles returns the circular dependencies of the graph, each one as the list
+// of cookbooks starting and ending with the same cookbook, e.g. [a b a]
+func (g *CookbookGraph) Cycles() [][]string {
+	return graphCycles(g.edges(), g.names())
+}
+
+// Closure returns the sorted names of the cookbooks the named cookbook
+// depends on, directly or transitively
+func (g *CookbookGraph) Closure(name string) []string {
+	return reachable(g.edges(), name)
+}
+
+// Dependents returns the sorted names of the cookbooks which depend on the
+// named cookbook, directly or transitively
+func (g *CookbookGraph) Dependents(name string) []string {
+	reverse := map[string][]string{}
+	for cookbook, deps := range g.edges() {
+		for _, dep := range deps {
+			reverse[dep] = append(reverse[dep], cookbook)
+		}
+	}
+	return reachable(reverse, name)
+}
+
+// reachable returns the sorted vertices which can be reached from a vertex,
+// not including the vertex itself unless it's part of a cycle
+func reachable(edges map[string][]string, from string) []string {
+	seen := map[string]string{}
+	queue := []string{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[current] {
+			if _, ok := seen[next]; !ok {
+				seen[next] = next
+				queue = append(queue, next)
+			}
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// DOT returns the graph in the Graphviz DOT format. Edges are labelled with
+// their version constraints, and unsatisfied dependencies are drawn in red.
+func (g *CookbookGraph) DOT() string {
+	unsatisfied := map[string]bool{}
+	for _, u := range g.Unsatisfied {
+		unsatisfied[u.Cookbook+" "+u.Dependency] = true
+	}
+
+	var dot strings.Builder
+	dot.WriteString("digraph cookbooks {\n")
+	missing := map[string]string{}
+	for _, name := range g.names() {
+		fmt.Fprintf(&dot, "  %q [label=%q];\n", name, name+" "+g.Versions[name])
+		for dep := range g.Dependencies[name] {
+			if _, ok := g.Versions[dep]; !ok {
+				missing[dep] = dep
+			}
+		}
+	}
+	for _, name := range sortedKeys(missing) {
+		fmt.Fprintf(&dot, "  %q [color=red];\n", name)
+	}
+	for _, name := range g.names() {
+		for _, dep := range sortedKeys(g.Dependencies[name]) {
+			color := ""
+			if unsatisfied[name+" "+dep] {
+				color = ", color=red"
+			}
+			fmt.Fprintf(&dot, "  %q -> %q [label=%q%s];\n", name, dep, g.Dependencies[name][dep], color)
+		}
+	}
+	dot.WriteString("}\n")
+	return dot.String()
+}
+
+// JSON returns the graph along with its cycles as indented JSON
+func (g *CookbookGraph) JSON() ([]byte, error) {
+	type cookbookJSON struct {
+		Version      string            `json:"version"`
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	type unsatisfiedJSON struct {
+		Cookbook   string   `json:"cookbook"`
+		Version    string   `json:"version"`
+		Dependency string   `json:"dependency"`
+		Constraint string   `json:"constraint"`
+		Available  []string `json:"available"`
+	}
+	cookbooks := map[string]cookbookJSON{}
+	for name, version := range g.Versions {
+		cookbooks[name] = cookbookJSON{version, g.Dependencies[name]}
+	}
+	unsatisfied := []unsatisfiedJSON{}
+	for _, u := range g.Unsatisfied {
+		unsatisfied = append(unsatisfied, unsatisfiedJSON(u))
+	}
+	return json.MarshalIndent(struct {
+		Cookbooks   map[string]cookbookJSON `json:"cookbooks"`
+		Unsatisfied []unsatisfiedJSON       `json:"unsatisfied"`
+		Cycles      [][]string              `json:"cycles"`
+	}{cookbooks, unsatisfied, g.Cycles()}, "", "  ")
+}
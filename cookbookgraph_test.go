@@ -0,0 +1,123 @@
+package chef
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewCookbookGraph(t *testing.T) {
+	graph, err := NewCookbookGraph([]*CookbookMetadata{
+		{Name: "apache2", Version: "2.0.0", Dependencies: map[string]string{"iptables": "~> 2.0", "logrotate": ">= 0.0.0"}},
+		{Name: "iptables", Version: "1.5.0"},
+		{Name: "logrotate", Version: "1.0.0", Dependencies: map[string]string{"cron": ">= 1.0"}},
+		{Name: "a", Version: "1.0.0", Dependencies: map[string]string{"b": ">= 0.0.0"}},
+		{Name: "b", Version: "1.0.0", Dependencies: map[string]string{"a": ">= 0.0.0", "apache2": ""}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsatisfied := []string{}
+	for _, u := range graph.Unsatisfied {
+		unsatisfied = append(unsatisfied, u.String())
+	}
+	expected := []string{
+		"apache2 2.0.0 depends on iptables ~> 2.0",
+		"logrotate 1.0.0 depends on cron >= 1.0",
+	}
+	if !reflect.DeepEqual(unsatisfied, expected) {
+		t.Errorf("unexpected unsatisfied dependencies %v", unsatisfied)
+	}
+
+	if cycles := graph.Cycles(); !reflect.DeepEqual(cycles, [][]string{{"a", "b", "a"}}) {
+		t.Errorf("unexpected cycles %v", cycles)
+	}
+	if closure := graph.Closure("b"); !reflect.DeepEqual(closure, []string{"a", "apache2", "b", "iptables", "logrotate"}) {
+		t.Errorf("unexpected closure %v", closure)
+	}
+	if dependents := graph.Dependents("iptables"); !reflect.DeepEqual(dependents, []string{"a", "apache2", "b"}) {
+		t.Errorf("unexpected dependents %v", dependents)
+	}
+
+	dot := graph.DOT()
+	for _, line := range []string{
+		`"apache2" [label="apache2 2.0.0"];`,
+		`"apache2" -> "iptables" [label="~> 2.0", color=red];`,
+		`"cron" [color=red];`,
+	} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("DOT output is missing %s", line)
+		}
+	}
+	if _, err := graph.JSON(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDepsolverGraph(t *testing.T) {
+	graph, err := testDepsolver(t).Graph("mysql", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Unsatisfied) != 1 || graph.Unsatisfied[0].Dependency != "openssl" {
+		t.Errorf("unexpected unsatisfied dependencies %v", graph.Unsatisfied)
+	}
+
+	// apache2 2.0.0 gets iptables 2.1.0, which logrotate 0.9.0 doesn't accept
+	graph, err = testDepsolver(t).Graph("apache2", "2.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"apache2": "2.0.0", "iptables": "2.1.0", "logrotate": "0.9.0"}
+	if !reflect.DeepEqual(graph.Versions, expected) {
+		t.Errorf("unexpected versions %v", graph.Versions)
+	}
+	if len(graph.Unsatisfied) != 1 || graph.Unsatisfied[0].Cookbook != "logrotate" {
+		t.Errorf("unexpected unsatisfied dependencies %v", graph.Unsatisfied)
+	}
+	if !reflect.DeepEqual(graph.Unsatisfied[0].Available, []string{"2.1.0", "1.5.0"}) {
+		t.Errorf("unexpected available versions %v", graph.Unsatisfied[0].Available)
+	}
+
+	if _, err := testDepsolver(t).Graph("apache2", "3.0.0"); err == nil {
+		t.Error("unknown cookbook versions should be reported")
+	}
+}
+
+func TestLoadCookbookGraph(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chef-graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestCookbook(t, filepath.Join(dir, "apache2"), map[string]string{
+		"metadata.rb": "name 'apache2'\nversion '1.0.0'\ndepends 'iptables', '>= 1.0'\n",
+	})
+	writeTestCookbook(t, filepath.Join(dir, "iptables"), map[string]string{
+		"metadata.rb": "name 'iptables'\nversion '1.2.0'\n",
+	})
+	graph, err := LoadCookbookGraph(filepath.Join(dir, "apache2"), filepath.Join(dir, "iptables"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Unsatisfied) != 0 || !reflect.DeepEqual(graph.Closure("apache2"), []string{"iptables"}) {
+		t.Errorf("unexpected graph %v", graph)
+	}
+}
+
+func TestGetCookbookVersionGraph(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	graph, err := chef.GetCookbookVersionGraph(config.RequiredCookbook.Name, config.RequiredCookbook.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if graph.Versions[config.RequiredCookbook.Name] != config.RequiredCookbook.Version {
+		t.Error("Required cookbook not found in the graph")
+	}
+}
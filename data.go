@@ -1,9 +1,13 @@
 package chef
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"net/http"
+	"regexp"
+	"sync"
 )
 
 // chef.GetData returns a map of databag names to their related REST URL
@@ -64,7 +68,7 @@ func (chef *Chef) GetDataByName(name string) (map[string]string, bool, error) {
 	}
 	body, err := responseBody(resp)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
+		if hasStatus(err, http.StatusNotFound) {
 			return nil, false, nil
 		}
 		return nil, false, err
@@ -75,3 +79,304 @@ func (chef *Chef) GetDataByName(name string) (map[string]string, bool, error) {
 
 	return data, true, nil
 }
+
+// dataBagNameRegexp matches the data bag names and item ids the Chef server
+// accepts
+var dataBagNameRegexp = regexp.MustCompile(`^[\.\-[:alnum:]_]+$`)
+
+// chef.DataBagItem represents a data bag item. Items are arbitrary JSON
+// objects, the only requirement being a string "id" field which names the
+// item within its data bag.
+type DataBagItem map[string]interface{}
+
+// ID returns the item's id, or an empty string if it doesn't have one
+func (item DataBagItem) ID() string {
+	id, _ := item["id"].(string)
+	return id
+}
+
+// validateDataBagItem checks that an item has a valid id
+func validateDataBagItem(item DataBagItem) error {
+	if _, ok := item["id"]; !ok {
+		return errors.New("data bag item must have an id")
+	}
+	if !dataBagNameRegexp.MatchString(item.ID()) {
+		return fmt.Errorf("invalid data bag item id '%v'", item["id"])
+	}
+	return nil
+}
+
+// chef.CreateDataBag creates a new, empty data bag with the given name.
+//
+// Usage:
+//
+//     err := chef.CreateDataBag("services")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) CreateDataBag(name string) error {
+	if !dataBagNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid data bag name '%s'", name)
+	}
+	payload, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		return err
+	}
+	resp, err := chef.Post("data", "application/json", nil, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// chef.DeleteDataBag deletes the data bag with the given name, along with all
+// of its items.
+//
+// Usage:
+//
+//     err := chef.DeleteDataBag("services")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) DeleteDataBag(name string) error {
+	resp, err := chef.Delete(fmt.Sprintf("data/%s", name), nil)
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// chef.GetDataBagItem returns the item with the given id from the given data
+// bag, a bool indicating whether or not the item was found and an error
+// indicating if the request failed or not.
+//
+// Usage:
+//
+//     item, ok, err := chef.GetDataBagItem("services", "billing")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     if !ok {
+//         fmt.Println("Couldn't find that item!")
+//     } else {
+//         fmt.Println(item["port"])
+//     }
+func (chef *Chef) GetDataBagItem(bag, id string) (DataBagItem, bool, error) {
+	body, ok, err := chef.getDataBagItemJSON(bag, id)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+
+	item := DataBagItem{}
+	if err := json.Unmarshal(body, &item); err != nil {
+		return nil, false, err
+	}
+
+	return item, true, nil
+}
+
+// getDataBagItemJSON returns the raw JSON of a data bag item
+func (chef *Chef) getDataBagItemJSON(bag, id string) ([]byte, bool, error) {
+	resp, err := chef.Get(fmt.Sprintf("data/%s/%s", bag, id))
+	if err != nil {
+		return nil, false, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		if hasStatus(err, http.StatusNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return body, true, nil
+}
+
+// chef.CreateDataBagItem creates a new item in the given data bag. The item
+// must have a valid "id" field.
+//
+// Usage:
+//
+//     item := chef.DataBagItem{"id": "billing", "port": 8080}
+//     err := chef.CreateDataBagItem("services", item)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) CreateDataBagItem(bag string, item DataBagItem) error {
+	if err := validateDataBagItem(item); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	resp, err := chef.Post(fmt.Sprintf("data/%s", bag), "application/json", nil, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// chef.UpdateDataBagItem reads the item with the given id, hands it to the
+// supplied function to be modified, and writes the result back to the server.
+// The updated item is returned. If the function returns an error, nothing is
+// written. The item's id can't be changed.
+//
+// Usage:
+//
+//     item, err := chef.UpdateDataBagItem("services", "billing", func(item chef.DataBagItem) error {
+//         item["port"] = 8081
+//         return nil
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) UpdateDataBagItem(bag, id string, update func(DataBagItem) error) (DataBagItem, error) {
+	item, ok, err := chef.GetDataBagItem(bag, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("data bag item %s/%s not found", bag, id)
+	}
+
+	if err := update(item); err != nil {
+		return nil, err
+	}
+	if err := validateDataBagItem(item); err != nil {
+		return nil, err
+	}
+	if item.ID() != id {
+		return nil, fmt.Errorf("data bag item id can't be changed from %s to %s", id, item.ID())
+	}
+
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chef.Put(fmt.Sprintf("data/%s/%s", bag, id), nil, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := responseBody(resp); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// chef.DeleteDataBagItem deletes the item with the given id from the given
+// data bag.
+//
+// Usage:
+//
+//     err := chef.DeleteDataBagItem("services", "billing")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) DeleteDataBagItem(bag, id string) error {
+	resp, err := chef.Delete(fmt.Sprintf("data/%s/%s", bag, id), nil)
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// chef.GetDataBagItemAs returns the item with the given id from the given data
+// bag decoded into a value of type T, usually a struct with json tags, a bool
+// indicating whether or not the item was found and an error indicating if the
+// request or the decoding failed.
+//
+// Usage:
+//
+//     type Service struct {
+//         ID    string   `json:"id"`
+//         Port  int      `json:"port"`
+//         Hosts []string `json:"hosts"`
+//     }
+//     service, ok, err := chef.GetDataBagItemAs[Service](c, "services", "billing")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     if ok {
+//         fmt.Println(service.Port)
+//     }
+func GetDataBagItemAs[T any](chef *Chef, bag, id string) (*T, bool, error) {
+	body, ok, err := chef.getDataBagItemJSON(bag, id)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	value := new(T)
+	if err := json.Unmarshal(body, value); err != nil {
+		return nil, false, fmt.Errorf("data bag item %s/%s: %s", bag, id, err)
+	}
+	return value, true, nil
+}
+
+// chef.GetDataBagItemsAs returns every item of the given data bag decoded into
+// a value of type T, sorted by item id. At most concurrency items are fetched
+// at the same time, or 10 if concurrency isn't positive. If any item can't be
+// fetched or decoded, the error of the first such item is returned.
+//
+// Usage:
+//
+//     services, err := chef.GetDataBagItemsAs[Service](c, "services", 5)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, service := range services {
+//         fmt.Println(service.ID, service.Port)
+//     }
+func GetDataBagItemsAs[T any](chef *Chef, bag string, concurrency int) ([]T, error) {
+	items, ok, err := chef.GetDataByName(bag)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("data bag %s not found", bag)
+	}
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+
+	ids := sortedKeys(items)
+	values := make([]T, len(ids))
+	errs := make([]error, len(ids))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			value, ok, err := GetDataBagItemAs[T](chef, bag, id)
+			switch {
+			case err != nil:
+				errs[i] = err
+			case !ok:
+				errs[i] = fmt.Errorf("data bag item %s/%s not found", bag, id)
+			default:
+				values[i] = *value
+			}
+		}(i, id)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
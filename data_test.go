@@ -34,3 +34,90 @@ func TestGetDataByName(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestValidateDataBagItem(t *testing.T) {
+	if err := validateDataBagItem(DataBagItem{"id": "billing-2.0_x"}); err != nil {
+		t.Error(err)
+	}
+	for _, item := range []DataBagItem{{}, {"id": ""}, {"id": 42}, {"id": "a b"}} {
+		if err := validateDataBagItem(item); err == nil {
+			t.Errorf("%v should be invalid", item)
+		}
+	}
+}
+
+func TestDataBagCRUD(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	bag := "chef_golang_test"
+
+	if err := chef.CreateDataBag(bag); err != nil {
+		t.Fatal(err)
+	}
+	defer chef.DeleteDataBag(bag)
+
+	item := DataBagItem{"id": "billing", "port": 8080, "hosts": []string{"a", "b"}}
+	if err := chef.CreateDataBagItem(bag, item); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := chef.UpdateDataBagItem(bag, "billing", func(item DataBagItem) error {
+		item["port"] = 8081
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, ok, err := chef.GetDataBagItem(bag, "billing")
+	if err != nil || !ok {
+		t.Fatal("Couldn't find updated item", err)
+	}
+	if item["port"] != float64(8081) {
+		t.Errorf("Item wasn't updated: %v", item)
+	}
+
+	if err := chef.DeleteDataBagItem(bag, "billing"); err != nil {
+		t.Error(err)
+	}
+	if _, ok, _ := chef.GetDataBagItem(bag, "billing"); ok {
+		t.Error("Item wasn't deleted")
+	}
+	if err := chef.DeleteDataBag(bag); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetDataBagItemsAs(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	bag := "chef_golang_typed_test"
+
+	if err := chef.CreateDataBag(bag); err != nil {
+		t.Fatal(err)
+	}
+	defer chef.DeleteDataBag(bag)
+	for _, id := range []string{"b", "a", "c"} {
+		if err := chef.CreateDataBagItem(bag, DataBagItem{"id": id, "port": 80}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type service struct {
+		ID   string `json:"id"`
+		Port int    `json:"port"`
+	}
+	item, ok, err := GetDataBagItemAs[service](chef, bag, "a")
+	if err != nil || !ok {
+		t.Fatal("Couldn't find item", err)
+	}
+	if item.ID != "a" || item.Port != 80 {
+		t.Errorf("unexpected item %v", item)
+	}
+
+	items, err := GetDataBagItemsAs[service](chef, bag, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || items[0].ID != "a" || items[2].ID != "c" {
+		t.Errorf("unexpected items %v", items)
+	}
+}
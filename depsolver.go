@@ -0,0 +1,521 @@
+package chef
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// chef.Depsolver resolves a run list to a set of cookbook versions the same way
+// the Chef server does when a node asks for its cookbooks. The cookbook data
+// can be loaded from the /universe endpoint, from the cookbook APIs or from
+// chef.CookbookVersion types that you already have at hand.
+type Depsolver struct {
+	// Cookbooks maps cookbook names to a map of version numbers to the
+	// dependencies (cookbook name to version constraint) of that version
+	Cookbooks map[string]map[string]map[string]string
+	// MaxSteps bounds the number of cookbook versions the solver tries before
+	// giving up, much like the server's depsolver timeout. Zero means no limit.
+	MaxSteps int
+}
+
+// chef.DepsolverError describes why a run list couldn't be solved: the cookbook
+// whose constraints couldn't be satisfied, every constraint that was placed on
+// it and by whom, and which versions of it are available.
+type DepsolverError struct {
+	Cookbook     string
+	Reason       string
+	Requirements []string
+	Available    []string
+}
+
+// Error returns a human readable explanation of the conflict
+func (e *DepsolverError) Error() string {
+	if e.Cookbook == "" {
+		return fmt.Sprintf("Unable to solve cookbook dependencies: %s", e.Reason)
+	}
+	msg := fmt.Sprintf("Unable to satisfy constraints on cookbook %s: %s", e.Cookbook, e.Reason)
+	if len(e.Requirements) > 0 {
+		msg += fmt.Sprintf("; constraints: %s", strings.Join(e.Requirements, ", "))
+	}
+	if len(e.Available) > 0 {
+		msg += fmt.Sprintf("; available versions: %s", strings.Join(e.Available, ", "))
+	}
+	return msg
+}
+
+// errDepsolverTimeout is returned when the solver exceeds Depsolver.MaxSteps
+var errDepsolverTimeout = &DepsolverError{Reason: "too many cookbook versions tried, giving up"}
+
+// chef.NewDepsolver returns an empty *chef.Depsolver. Use AddCookbookVersion or
+// AddUniverse to teach it about the available cookbooks.
+func NewDepsolver() *Depsolver {
+	return &Depsolver{
+		Cookbooks: map[string]map[string]map[string]string{},
+		MaxSteps:  100000,
+	}
+}
+
+// AddCookbookVersion adds a single cookbook version, and its dependencies as
+// found in the cookbook's metadata, to the solver
+func (d *Depsolver) AddCookbookVersion(cookbook *CookbookVersion) error {
+	name := cookbook.Metadata.Name
+	if name == "" {
+		name = cookbook.Name
+	}
+	version := cookbook.Metadata.Version
+	if version == "" {
+		version = cookbook.Version
+	}
+	return d.add(name, version, cookbook.Metadata.Dependencies)
+}
+
+// AddUniverse adds every cookbook version found in the result of
+// chef.GetUniverse to the solver
+func (d *Depsolver) AddUniverse(universe map[string]map[string]*UniverseEntry) error {
+	for name, versions := range universe {
+		for version, entry := range versions {
+			if err := d.add(name, version, entry.Dependencies); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Depsolver) add(name, version string, dependencies map[string]string) error {
+	v, err := ParseVersion(version)
+	if err != nil {
+		return fmt.Errorf("cookbook %s: %s", name, err)
+	}
+	if d.Cookbooks[name] == nil {
+		d.Cookbooks[name] = map[string]map[string]string{}
+	}
+	deps := map[string]string{}
+	for dep, constraint := range dependencies {
+		deps[dep] = constraint
+	}
+	d.Cookbooks[name][v.String()] = deps
+	return nil
+}
+
+// chef.NewDepsolverFromUniverse returns a *chef.Depsolver which knows about
+// every cookbook version on the server, as reported by the /universe endpoint.
+// This is by far the cheapest way of loading the solver.
+//
+// Usage:
+//
+//     solver, err := chef.NewDepsolverFromUniverse()
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     cookbooks, err := solver.Solve([]string{"recipe[apache2]"}, nil)
+func (chef *Chef) NewDepsolverFromUniverse() (*Depsolver, error) {
+	universe, err := chef.GetUniverse()
+	if err != nil {
+		return nil, err
+	}
+	solver := NewDepsolver()
+	if err := solver.AddUniverse(universe); err != nil {
+		return nil, err
+	}
+	return solver, nil
+}
+
+// chef.NewDepsolverFromCookbooks returns a *chef.Depsolver which knows about
+// every cookbook version on the server by walking the cookbook APIs. This is
+// useful for servers which don't implement /universe, but it costs one request
+// per cookbook version.
+func (chef *Chef) NewDepsolverFromCookbooks() (*Depsolver, error) {
+	cookbooks, err := chef.GetCookbooksWithVersions(AllVersions)
+	if err != nil {
+		return nil, err
+	}
+	solver := NewDepsolver()
+	for name, cookbook := range cookbooks {
+		for _, version := range cookbook.Versions {
+			cookbookVersion, ok, err := chef.GetCookbookVersion(name, version.Version)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			if err := solver.AddCookbookVersion(cookbookVersion); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return solver, nil
+}
+
+// depRequirement is a single constraint placed on a cookbook while solving,
+// along with a description of where it came from
+type depRequirement struct {
+	name       string
+	constraint VersionConstraint
+	source     string
+}
+
+func (r depRequirement) String() string {
+	return fmt.Sprintf("%s (%s) required by %s", r.name, r.constraint, r.source)
+}
+
+// runListCookbook returns the cookbook name and the optional version of a run
+// list item such as "recipe[apache2::mod_ssl]", "apache2" or "apache2@1.0.0"
+func runListCookbook(item string) (string, string, error) {
+	entry := strings.TrimSpace(item)
+	if strings.HasPrefix(entry, "role[") {
+		return "", "", fmt.Errorf("run list item '%s' is a role, roles must be expanded before solving", item)
+	}
+	if strings.HasPrefix(entry, "recipe[") && strings.HasSuffix(entry, "]") {
+		entry = entry[len("recipe[") : len(entry)-1]
+	}
+	var version string
+	if i := strings.Index(entry, "@"); i != -1 {
+		entry, version = entry[:i], entry[i+1:]
+	}
+	name := strings.SplitN(entry, "::", 2)[0]
+	if name == "" || strings.ContainsAny(name, "[] ") {
+		return "", "", fmt.Errorf("invalid run list item '%s'", item)
+	}
+	return name, version, nil
+}
+
+// Solve accepts a run list, which must only contain recipes, and a map of
+// cookbook names to version constraints (such as an environment's
+// CookbookVersions) and returns a map of cookbook names to the version of each
+// cookbook that the node would receive. Newer versions are always preferred.
+// If the run list can't be solved, the error is a *chef.DepsolverError which
+// explains the conflict.
+//
+// Usage:
+//
+//     cookbooks, err := solver.Solve([]string{"recipe[apache2]"}, map[string]string{
+//         "apache2": "~> 1.10",
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for name, version := range cookbooks {
+//         fmt.Println(name, version)
+//     }
+func (d *Depsolver) Solve(runList []string, pins map[string]string) (map[string]string, error) {
+	state := &depState{
+		solver:       d,
+		chosen:       map[string]Version{},
+		requirements: map[string][]depRequirement{},
+	}
+
+	for name, pin := range pins {
+		constraint, err := ParseVersionConstraint(pin)
+		if err != nil {
+			return nil, fmt.Errorf("environment pin for %s: %s", name, err)
+		}
+		state.requirements[name] = []depRequirement{{name, constraint, "environment pin"}}
+	}
+
+	queue := []depRequirement{}
+	for _, item := range runList {
+		name, version, err := runListCookbook(item)
+		if err != nil {
+			return nil, err
+		}
+		constraint, err := ParseVersionConstraint(version)
+		if err != nil {
+			return nil, fmt.Errorf("run list item '%s': %s", item, err)
+		}
+		queue = append(queue, depRequirement{name, constraint, fmt.Sprintf("run list item '%s'", item)})
+	}
+
+	if err := state.solve(queue); err != nil {
+		return nil, err
+	}
+
+	solution := map[string]string{}
+	for name, version := range state.chosen {
+		solution[name] = version.String()
+	}
+	return solution, nil
+}
+
+// SolveEnvironment is like Solve, but uses the cookbook version pins of the
+// supplied environment
+func (d *Depsolver) SolveEnvironment(env *Environment, runList []string) (map[string]string, error) {
+	return d.Solve(runList, env.CookbookVersions)
+}
+
+type depState struct {
+	solver       *Depsolver
+	chosen       map[string]Version
+	requirements map[string][]depRequirement
+	steps        int
+}
+
+// solve works through the queue of requirements depth first, choosing the
+// newest version of each cookbook which satisfies every constraint seen so
+// far, and backtracking when a later constraint can't be met
+func (s *depState) solve(queue []depRequirement) error {
+	if len(queue) == 0 {
+		return nil
+	}
+	req, rest := queue[0], queue[1:]
+
+	previous := s.requirements[req.name]
+	s.requirements[req.name] = append(previous[:len(previous):len(previous)], req)
+	defer func() { s.requirements[req.name] = previous }()
+
+	if chosen, ok := s.chosen[req.name]; ok {
+		if !req.constraint.Satisfies(chosen) {
+			return s.conflict(req.name, fmt.Sprintf("version %s was already selected", chosen))
+		}
+		return s.solve(rest)
+	}
+
+	versions, ok := s.solver.Cookbooks[req.name]
+	if !ok {
+		return s.conflict(req.name, "no such cookbook")
+	}
+
+	var firstErr error
+	for _, candidate := range s.candidates(req.name) {
+		s.steps++
+		if s.solver.MaxSteps > 0 && s.steps > s.solver.MaxSteps {
+			return errDepsolverTimeout
+		}
+
+		next, err := dependencyRequirements(req.name, candidate, versions[candidate.String()])
+		if err != nil {
+			return err
+		}
+
+		s.chosen[req.name] = candidate
+		err = s.solve(append(next, rest...))
+		if err == nil {
+			return nil
+		}
+		delete(s.chosen, req.name)
+
+		if err == errDepsolverTimeout {
+			return err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if firstErr == nil {
+		return s.conflict(req.name, "no version satisfies all constraints")
+	}
+	return firstErr
+}
+
+// candidates returns the versions of a cookbook which satisfy every constraint
+// currently placed on it, newest first
+func (s *depState) candidates(name string) []Version {
+	versions := []string{}
+	for version := range s.solver.Cookbooks[name] {
+		versions = append(versions, version)
+	}
+
+	candidates := []Version{}
+	for _, version := range sortVersionsDescending(versions) {
+		ok := true
+		for _, req := range s.requirements[name] {
+			if !req.constraint.Satisfies(version) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			candidates = append(candidates, version)
+		}
+	}
+	return candidates
+}
+
+func (s *depState) conflict(name, reason string) error {
+	err := &DepsolverError{Cookbook: name, Reason: reason}
+	for _, req := range s.requirements[name] {
+		err.Requirements = append(err.Requirements, req.String())
+	}
+	versions := []string{}
+	for version := range s.solver.Cookbooks[name] {
+		versions = append(versions, version)
+	}
+	for _, version := range sortVersionsDescending(versions) {
+		err.Available = append(err.Available, version.String())
+	}
+	return err
+}
+
+// dependencyRequirements turns the dependencies of a cookbook version into
+// requirements, in a stable order so that solving is deterministic
+func dependencyRequirements(name string, version Version, dependencies map[string]string) ([]depRequirement, error) {
+	names := []string{}
+	for dep := range dependencies {
+		names = append(names, dep)
+	}
+	sort.Strings(names)
+
+	source := fmt.Sprintf("%s %s", name, version)
+	requirements := []depRequirement{}
+	for _, dep := range names {
+		constraint, err := ParseVersionConstraint(dependencies[dep])
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s of %s: %s", dep, source, err)
+		}
+		requirements = append(requirements, depRequirement{dep, constraint, source})
+	}
+	return requirements, nil
+}
+
+// chef.SolveEnvironmentCookbooks asks the server's depsolver which cookbook
+// versions a node in the given environment with the given run list would
+// receive. It returns a map of cookbook names to *chef.CookbookVersion types.
+// If the server can't solve the run list, the error is a *chef.DepsolverError
+// carrying the server's explanation.
+//
+// Usage:
+//
+//     cookbooks, err := chef.SolveEnvironmentCookbooks("production", []string{"recipe[apache2]"})
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for name, cookbook := range cookbooks {
+//         fmt.Println(name, cookbook.Version)
+//     }
+func (chef *Chef) SolveEnvironmentCookbooks(env string, runList []string) (map[string]*CookbookVersion, error) {
+	payload, err := json.Marshal(map[string][]string{"run_list": runList})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chef.Post(fmt.Sprintf("environments/%s/cookbook_versions", env), "application/json", nil, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &DepsolverError{Reason: chefErrorMessage(body, resp.Status)}
+	}
+
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	cookbooks := map[string]*CookbookVersion{}
+	if err := json.Unmarshal(body, &cookbooks); err != nil {
+		return nil, err
+	}
+
+	return cookbooks, nil
+}
+
+// chef.DepsolverComparison holds the local and the server's answer for the
+// same run list, as returned by Depsolver.CrossCheck
+type DepsolverComparison struct {
+	Local       map[string]string
+	LocalError  error
+	Server      map[string]string
+	ServerError error
+	Mismatches  []DepsolverMismatch
+}
+
+// chef.DepsolverMismatch is a cookbook for which the local solver and the
+// server disagree. An empty version means the cookbook wasn't part of that
+// solution.
+type DepsolverMismatch struct {
+	Cookbook string
+	Local    string
+	Server   string
+}
+
+// Agree returns true if both solvers solved the run list to the same cookbook
+// versions, or if both failed to solve it
+func (c *DepsolverComparison) Agree() bool {
+	if c.LocalError != nil || c.ServerError != nil {
+		return c.LocalError != nil && c.ServerError != nil
+	}
+	return len(c.Mismatches) == 0
+}
+
+// CrossCheck solves the run list locally for the given environment and asks
+// the server to do the same, reporting any difference between the two. The
+// returned error is only set if the server couldn't be queried; solving
+// failures are reported in the comparison itself.
+//
+// Usage:
+//
+//     comparison, err := solver.CrossCheck(chef, environment, runList)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     if !comparison.Agree() {
+//         for _, mismatch := range comparison.Mismatches {
+//             fmt.Println(mismatch.Cookbook, mismatch.Local, mismatch.Server)
+//         }
+//     }
+func (d *Depsolver) CrossCheck(chef *Chef, env *Environment, runList []string) (*DepsolverComparison, error) {
+	comparison := new(DepsolverComparison)
+	comparison.Local, comparison.LocalError = d.SolveEnvironment(env, runList)
+
+	cookbooks, err := chef.SolveEnvironmentCookbooks(env.Name, runList)
+	if err != nil {
+		var solveErr *DepsolverError
+		if !errors.As(err, &solveErr) {
+			return nil, err
+		}
+		comparison.ServerError = err
+	} else {
+		comparison.Server = map[string]string{}
+		for name, cookbook := range cookbooks {
+			version := cookbook.Version
+			if v, err := ParseVersion(version); err == nil {
+				version = v.String()
+			}
+			comparison.Server[name] = version
+		}
+	}
+
+	if comparison.LocalError != nil || comparison.ServerError != nil {
+		return comparison, nil
+	}
+
+	names := map[string]bool{}
+	for name := range comparison.Local {
+		names[name] = true
+	}
+	for name := range comparison.Server {
+		names[name] = true
+	}
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		if comparison.Local[name] != comparison.Server[name] {
+			comparison.Mismatches = append(comparison.Mismatches, DepsolverMismatch{
+				Cookbook: name,
+				Local:    comparison.Local[name],
+				Server:   comparison.Server[name],
+			})
+		}
+	}
+	return comparison, nil
+}
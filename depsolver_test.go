@@ -0,0 +1,92 @@
+package chef
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testDepsolver(t *testing.T) *Depsolver {
+	solver := NewDepsolver()
+	universe := map[string]map[string]*UniverseEntry{
+		"apache2": {
+			"1.0.0": {Dependencies: map[string]string{"iptables": ">= 0.0.0"}},
+			"2.0.0": {Dependencies: map[string]string{"iptables": "~> 2.0", "logrotate": "< 1.0"}},
+		},
+		"iptables": {
+			"1.5.0": {},
+			"2.1.0": {},
+		},
+		"logrotate": {
+			"0.9.0": {Dependencies: map[string]string{"iptables": "< 2.0"}},
+			"1.0.0": {},
+		},
+		"mysql": {
+			"1.0.0": {Dependencies: map[string]string{"openssl": ">= 1.0"}},
+		},
+	}
+	if err := solver.AddUniverse(universe); err != nil {
+		t.Fatal(err)
+	}
+	return solver
+}
+
+func TestDepsolverSolve(t *testing.T) {
+	solver := testDepsolver(t)
+
+	// apache2 2.0.0 needs iptables ~> 2.0 but logrotate 0.9.0 needs
+	// iptables < 2.0, so the solver has to fall back to apache2 1.0.0
+	solution, err := solver.Solve([]string{"recipe[apache2::mod_ssl]"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"apache2": "1.0.0", "iptables": "2.1.0"}
+	if !reflect.DeepEqual(solution, expected) {
+		t.Errorf("unexpected solution %v", solution)
+	}
+
+	solution, err = solver.SolveEnvironment(&Environment{
+		CookbookVersions: map[string]string{"iptables": "= 1.5.0"},
+	}, []string{"apache2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]string{"apache2": "1.0.0", "iptables": "1.5.0"}
+	if !reflect.DeepEqual(solution, expected) {
+		t.Errorf("unexpected solution %v", solution)
+	}
+}
+
+func TestDepsolverConflicts(t *testing.T) {
+	solver := testDepsolver(t)
+
+	_, err := solver.Solve([]string{"apache2@2.0.0"}, nil)
+	solveErr, ok := err.(*DepsolverError)
+	if !ok {
+		t.Fatalf("expected a *DepsolverError, got %v", err)
+	}
+	if solveErr.Cookbook != "iptables" || !strings.Contains(err.Error(), "logrotate 0.9.0") {
+		t.Errorf("conflict isn't explained: %s", err)
+	}
+
+	_, err = solver.Solve([]string{"mysql"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "no such cookbook") {
+		t.Errorf("missing cookbook isn't reported: %v", err)
+	}
+
+	if _, err = solver.Solve([]string{"role[base]"}, nil); err == nil {
+		t.Error("roles should be refused")
+	}
+}
+
+func TestSolveEnvironmentCookbooks(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	cookbooks, err := chef.SolveEnvironmentCookbooks(config.RequiredEnvironment.Name, []string{config.RequiredCookbook.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookbooks[config.RequiredCookbook.Name] == nil {
+		t.Error("Required cookbook not solved")
+	}
+}
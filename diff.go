@@ -0,0 +1,490 @@
+package chef
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// chef.CookbookDiff describes what changed between two cookbook versions: the
+// files which were added, removed or modified in each segment, the metadata
+// fields which changed and the dependencies which changed.
+type CookbookDiff struct {
+	From         string
+	To           string
+	Files        []CookbookFileChange
+	Metadata     []MetadataChange
+	Dependencies []DependencyChange
+}
+
+// chef.CookbookFileChange is a file which was added, removed or modified
+// between two cookbook versions. Change is one of "added", "removed" or
+// "modified". Diff holds a unified diff of the file when it was requested and
+// the file is text.
+type CookbookFileChange struct {
+	Segment     string
+	Path        string
+	Change      string
+	OldChecksum string
+	NewChecksum string
+	Diff        string
+
+	old *CookbookItem
+	new *CookbookItem
+}
+
+// chef.MetadataChange is a metadata field which changed between two cookbook
+// versions. Map fields such as platforms or recipes are reported per key, e.g.
+// "platforms/ubuntu". An empty value means the field or key wasn't set.
+type MetadataChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// chef.DependencyChange is a dependency which was added, removed or whose
+// version constraint changed between two cookbook versions. An empty
+// constraint means the dependency didn't exist on that side.
+type DependencyChange struct {
+	Cookbook string
+	Old      string
+	New      string
+}
+
+// Empty returns true if the two cookbook versions are identical
+func (d *CookbookDiff) Empty() bool {
+	return len(d.Files) == 0 && len(d.Metadata) == 0 && len(d.Dependencies) == 0
+}
+
+// BySegment returns the file changes grouped by segment, such as "recipes" or
+// "templates"
+func (d *CookbookDiff) BySegment() map[string][]CookbookFileChange {
+	segments := map[string][]CookbookFileChange{}
+	for _, change := range d.Files {
+		segments[change.Segment] = append(segments[change.Segment], change)
+	}
+	return segments
+}
+
+// chef.DiffCookbookVersions compares two cookbook versions, which may come
+// from the server or from chef.LoadCookbookVersion, using the checksums of
+// their files. It doesn't fetch any file content; use
+// chef.DiffCookbookVersionsWithContent to get unified diffs as well.
+//
+// Usage:
+//
+//     old, _, _ := chef.GetCookbookVersion("apache2", "1.10.2")
+//     new, _ := chef.LoadCookbookVersion("cookbooks/apache2")
+//     diff := chef.DiffCookbookVersions(old, new)
+//     for _, change := range diff.Files {
+//         fmt.Println(change.Change, change.Path)
+//     }
+//     for _, change := range diff.Dependencies {
+//         fmt.Println(change.Cookbook, change.Old, "->", change.New)
+//     }
+func DiffCookbookVersions(from, to *CookbookVersion) *CookbookDiff {
+	diff := &CookbookDiff{
+		From: fmt.Sprintf("%s %s", from.Metadata.Name, from.Metadata.Version),
+		To:   fmt.Sprintf("%s %s", to.Metadata.Name, to.Metadata.Version),
+	}
+
+	for _, segment := range cookbookSegments {
+		oldItems := map[string]CookbookItem{}
+		for _, item := range from.segmentItems(segment) {
+			oldItems[item.Path] = item
+		}
+		newItems := map[string]CookbookItem{}
+		for _, item := range to.segmentItems(segment) {
+			newItems[item.Path] = item
+		}
+
+		paths := map[string]string{}
+		for path := range oldItems {
+			paths[path] = path
+		}
+		for path := range newItems {
+			paths[path] = path
+		}
+		for _, path := range sortedKeys(paths) {
+			oldItem, inOld := oldItems[path]
+			newItem, inNew := newItems[path]
+			change := CookbookFileChange{Segment: segment, Path: path}
+			switch {
+			case !inNew:
+				change.Change = "removed"
+				change.OldChecksum = oldItem.Checksum
+				change.old = &oldItem
+			case !inOld:
+				change.Change = "added"
+				change.NewChecksum = newItem.Checksum
+				change.new = &newItem
+			case oldItem.Checksum != newItem.Checksum:
+				change.Change = "modified"
+				change.OldChecksum = oldItem.Checksum
+				change.NewChecksum = newItem.Checksum
+				change.old = &oldItem
+				change.new = &newItem
+			default:
+				continue
+			}
+			diff.Files = append(diff.Files, change)
+		}
+	}
+
+	oldMeta, newMeta := from.Metadata, to.Metadata
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"name", oldMeta.Name, newMeta.Name},
+		{"version", oldMeta.Version, newMeta.Version},
+		{"description", oldMeta.Description, newMeta.Description},
+		{"long_description", oldMeta.LongDescription, newMeta.LongDescription},
+		{"maintainer", oldMeta.Maintainer, newMeta.Maintainer},
+		{"maintainer_email", oldMeta.MaintainerEmail, newMeta.MaintainerEmail},
+		{"license", oldMeta.License, newMeta.License},
+	}
+	for _, field := range fields {
+		if field.old != field.new {
+			diff.Metadata = append(diff.Metadata, MetadataChange{field.name, field.old, field.new})
+		}
+	}
+	diff.Metadata = append(diff.Metadata, diffStringMaps("platforms", oldMeta.Platforms, newMeta.Platforms)...)
+	diff.Metadata = append(diff.Metadata, diffStringMaps("providing", oldMeta.Providing, newMeta.Providing)...)
+	diff.Metadata = append(diff.Metadata, diffStringMaps("recipes", oldMeta.Recipes, newMeta.Recipes)...)
+	diff.Metadata = append(diff.Metadata, diffStringMaps("attributes", jsonStrings(oldMeta.Attributes), jsonStrings(newMeta.Attributes))...)
+
+	for _, change := range diffStringMaps("", oldMeta.Dependencies, newMeta.Dependencies) {
+		diff.Dependencies = append(diff.Dependencies, DependencyChange{change.Field, change.Old, change.New})
+	}
+
+	return diff
+}
+
+// chef.DiffCookbookVersionsWithContent is like chef.DiffCookbookVersions, but
+// also fetches both sides of every added, removed or modified text file with
+// chef.GetCookbookItemContent and fills in the unified diff of each. Binary
+// files only get checksums. The receiver may be nil if both cookbook versions
+// were loaded from disk.
+//
+// Usage:
+//
+//     diff, err := chef.DiffCookbookVersionsWithContent(old, new)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, change := range diff.Files {
+//         fmt.Print(change.Diff)
+//     }
+func (chef *Chef) DiffCookbookVersionsWithContent(from, to *CookbookVersion) (*CookbookDiff, error) {
+	diff := DiffCookbookVersions(from, to)
+	for i := range diff.Files {
+		change := &diff.Files[i]
+		var oldContent, newContent []byte
+		var err error
+		if change.old != nil {
+			if oldContent, err = chef.GetCookbookItemContent(from, *change.old); err != nil {
+				return nil, err
+			}
+		}
+		if change.new != nil {
+			if newContent, err = chef.GetCookbookItemContent(to, *change.new); err != nil {
+				return nil, err
+			}
+		}
+		if !isText(oldContent) || !isText(newContent) {
+			continue
+		}
+		oldName, newName := "a/"+change.Path, "b/"+change.Path
+		if change.old == nil {
+			oldName = "/dev/null"
+		}
+		if change.new == nil {
+			newName = "/dev/null"
+		}
+		change.Diff = UnifiedDiff(oldName, newName, string(oldContent), string(newContent), 3)
+	}
+	return diff, nil
+}
+
+// diffStringMaps compares two maps of strings key by key, prefixing the
+// reported field names with the supplied prefix
+func diffStringMaps(prefix string, old, new map[string]string) []MetadataChange {
+	changes := []MetadataChange{}
+	for _, key := range sortedKeys(old, new) {
+		if old[key] == new[key] {
+			continue
+		}
+		field := key
+		if prefix != "" {
+			field = prefix + "/" + key
+		}
+		changes = append(changes, MetadataChange{field, old[key], new[key]})
+	}
+	return changes
+}
+
+// jsonStrings encodes every value of a map as JSON so that arbitrary values
+// can be compared and reported
+func jsonStrings(m map[string]interface{}) map[string]string {
+	strs := map[string]string{}
+	for key, value := range m {
+		encoded, _ := json.Marshal(value)
+		strs[key] = string(encoded)
+	}
+	return strs
+}
+
+// sortedKeys returns the union of the keys of the supplied maps, sorted
+func sortedKeys(maps ...map[string]string) []string {
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isText guesses whether some content is text the same way git does: text
+// doesn't contain NUL bytes. Invalid UTF-8 is treated as binary too.
+func isText(content []byte) bool {
+	sample := content
+	if len(sample) > 8000 {
+		sample = sample[:8000]
+	}
+	return bytes.IndexByte(sample, 0) == -1 && utf8.Valid(content)
+}
+
+// chef.UnifiedDiff returns the unified diff between two texts, with the given
+// number of context lines around each change, or an empty string if the texts
+// are identical
+func UnifiedDiff(oldName, newName, old, new string, context int) string {
+	a, b := splitLines(old), splitLines(new)
+	ops := diffLines(a, b)
+
+	changes := []int{}
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(changes); {
+		// merge changes which are close enough to share context
+		last := changes[i]
+		j := i + 1
+		for j < len(changes) && changes[j]-last <= 2*context {
+			last = changes[j]
+			j++
+		}
+		start := changes[i] - context
+		if start < 0 {
+			start = 0
+		}
+		end := last + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		oldStart, newStart := ops[start].oldLine, ops[start].newLine
+		oldCount, newCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		if oldCount > 0 {
+			oldStart++
+		}
+		if newCount > 0 {
+			newStart++
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+		i = j
+	}
+	return out.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffOp is a single line of an edit script: ' ' for a line both texts share,
+// '-' for a line only in the old text and '+' for a line only in the new one.
+// oldLine and newLine are the number of lines of each text before this one.
+type diffOp struct {
+	kind    byte
+	text    string
+	oldLine int
+	newLine int
+}
+
+// diffLines computes the shortest edit script between two slices of lines
+// with the linear space variant of Myers' algorithm, so that large files with
+// many differences don't need memory proportional to their size times the
+// number of differences
+func diffLines(a, b []string) []diffOp {
+	size := len(a) + len(b) + 2
+	differ := &lineDiffer{
+		a:       a,
+		b:       b,
+		forward: make([]int, 2*size+1),
+		back:    make([]int, 2*size+1),
+		offset:  size,
+	}
+	differ.compare(0, len(a), 0, len(b))
+
+	// within each change, list the removed lines before the added ones
+	ops := differ.ops
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j].kind != ' ' {
+			j++
+		}
+		change := ops[i:j]
+		sort.SliceStable(change, func(x, y int) bool {
+			return change[x].kind == '-' && change[y].kind == '+'
+		})
+		i = j
+	}
+
+	oldLine, newLine := 0, 0
+	for i := range ops {
+		ops[i].oldLine, ops[i].newLine = oldLine, newLine
+		if ops[i].kind != '+' {
+			oldLine++
+		}
+		if ops[i].kind != '-' {
+			newLine++
+		}
+	}
+	return ops
+}
+
+// lineDiffer holds the state of diffLines: the furthest reaching paths of
+// the forward and backward searches, indexed by diagonal plus offset, and the
+// edit script so far
+type lineDiffer struct {
+	a, b          []string
+	forward, back []int
+	offset        int
+	ops           []diffOp
+}
+
+// compare appends the edit script between a[aLo:aHi] and b[bLo:bHi]
+func (d *lineDiffer) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.ops = append(d.ops, diffOp{kind: ' ', text: d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for ; bLo < bHi; bLo++ {
+			d.ops = append(d.ops, diffOp{kind: '+', text: d.b[bLo]})
+		}
+	case bLo == bHi:
+		for ; aLo < aHi; aLo++ {
+			d.ops = append(d.ops, diffOp{kind: '-', text: d.a[aLo]})
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		for ; x < u; x++ {
+			d.ops = append(d.ops, diffOp{kind: ' ', text: d.a[x]})
+		}
+		d.compare(u, aHi, v, bHi)
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.ops = append(d.ops, diffOp{kind: ' ', text: d.a[aHi+i]})
+	}
+}
+
+// middleSnake searches the shortest edit script between a[aLo:aHi] and
+// b[bLo:bHi] from both ends at once, and returns the start and end of the
+// snake, the run of common lines, where the searches meet
+func (d *lineDiffer) middleSnake(aLo, aHi, bLo, bHi int) (int, int, int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	forward, back, offset := d.forward, d.back, d.offset
+	forward[offset+1] = 0
+	back[offset+1] = 0
+
+	for depth := 0; depth <= (n+m+1)/2; depth++ {
+		for k := -depth; k <= depth; k += 2 {
+			var x int
+			if k == -depth || (k != depth && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			// the backward search runs on diagonal delta-k, reversed
+			if odd && delta-k >= -(depth-1) && delta-k <= depth-1 && x+back[offset+delta-k] >= n {
+				return aLo + startX, bLo + startY, aLo + x, bLo + y
+			}
+		}
+		for k := -depth; k <= depth; k += 2 {
+			var x int
+			if k == -depth || (k != depth && back[offset+k-1] < back[offset+k+1]) {
+				x = back[offset+k+1]
+			} else {
+				x = back[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			back[offset+k] = x
+			if !odd && delta-k >= -depth && delta-k <= depth && x+forward[offset+delta-k] >= n {
+				return aHi - x, bHi - y, aHi - startX, bHi - startY
+			}
+		}
+	}
+	panic("diffLines: no middle snake")
+}
@@ -0,0 +1,187 @@
+package chef
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	expected := `--- a/x
++++ b/x
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -8,3 +8,4 @@
+ h
+ i
+ j
++k
+`
+	if diff := UnifiedDiff("a/x", "b/x", old, new, 3); diff != expected {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+	if diff := UnifiedDiff("a/x", "b/x", old, old, 3); diff != "" {
+		t.Errorf("identical texts shouldn't differ:\n%s", diff)
+	}
+	expected = "--- /dev/null\n+++ b/x\n@@ -0,0 +1,2 @@\n+a\n+b\n"
+	if diff := UnifiedDiff("/dev/null", "b/x", "", "a\nb\n", 3); diff != expected {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+}
+
+func TestDiffLinesIsMinimal(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		l := make([]string, random.Intn(30))
+		for i := range l {
+			l[i] = string(rune('a' + random.Intn(4)))
+		}
+		return l
+	}
+	for i := 0; i < 500; i++ {
+		a, b := lines(), lines()
+		ops := diffLines(a, b)
+
+		// the script must turn a into b
+		var old, new []string
+		edits := 0
+		for _, op := range ops {
+			if op.kind != '+' {
+				old = append(old, op.text)
+			}
+			if op.kind != '-' {
+				new = append(new, op.text)
+			}
+			if op.kind != ' ' {
+				edits++
+			}
+		}
+		if strings.Join(old, "") != strings.Join(a, "") || strings.Join(new, "") != strings.Join(b, "") {
+			t.Fatalf("%v doesn't turn %v into %v", ops, a, b)
+		}
+
+		// and be as short as the longest common subsequence allows
+		lcs := make([][]int, len(a)+1)
+		for x := range lcs {
+			lcs[x] = make([]int, len(b)+1)
+		}
+		for x := len(a) - 1; x >= 0; x-- {
+			for y := len(b) - 1; y >= 0; y-- {
+				if a[x] == b[y] {
+					lcs[x][y] = lcs[x+1][y+1] + 1
+				} else if lcs[x+1][y] > lcs[x][y+1] {
+					lcs[x][y] = lcs[x+1][y]
+				} else {
+					lcs[x][y] = lcs[x][y+1]
+				}
+			}
+		}
+		if shortest := len(a) + len(b) - 2*lcs[0][0]; edits != shortest {
+			t.Fatalf("%d edits between %v and %v instead of %d", edits, a, b, shortest)
+		}
+	}
+}
+
+func writeTestCookbook(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiffCookbookVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chef-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestCookbook(t, filepath.Join(dir, "old"), map[string]string{
+		"metadata.rb":                  "name 'app'\nversion '1.0.0'\ndepends 'iptables'\n",
+		"recipes/default.rb":           "package 'app'\n",
+		"recipes/old.rb":               "log 'old'\n",
+		"templates/default/app.conf":   "port 80\n",
+		"files/default/logo.png":       "\x89PNG\x00",
+		"spec/default_spec.rb":         "ignored\n",
+		"attributes/default.rb":        "default['app']['port'] = 80\n",
+		"recipes/not_a_recipe.txt":     "ignored\n",
+		"templates/ubuntu/app.conf":    "port 8080\n",
+		"libraries/helpers/helpers.rb": "module Helpers; end\n",
+	})
+	writeTestCookbook(t, filepath.Join(dir, "new"), map[string]string{
+		"metadata.rb":                  "name 'app'\nversion '1.1.0'\ndepends 'iptables', '~> 2.0'\ndepends 'logrotate'\n",
+		"recipes/default.rb":           "package 'app'\nservice 'app'\n",
+		"recipes/new.rb":               "log 'new'\n",
+		"templates/default/app.conf":   "port 80\n",
+		"files/default/logo.png":       "\x89PNG\x00\x01",
+		"attributes/default.rb":        "default['app']['port'] = 80\n",
+		"templates/ubuntu/app.conf":    "port 8080\n",
+		"libraries/helpers/helpers.rb": "module Helpers; end\n",
+	})
+
+	old, err := LoadCookbookVersion(filepath.Join(dir, "old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := LoadCookbookVersion(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(old.Recipes) != 2 || len(old.Templates) != 2 || old.Templates[1].Specificity != "ubuntu" {
+		t.Errorf("unexpected cookbook manifest %#v", old)
+	}
+
+	diff, err := (*Chef)(nil).DiffCookbookVersionsWithContent(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := map[string]string{}
+	for _, change := range diff.Files {
+		changes[change.Path] = change.Change
+	}
+	expected := map[string]string{
+		"files/default/logo.png": "modified",
+		"metadata.rb":            "modified",
+		"recipes/default.rb":     "modified",
+		"recipes/new.rb":         "added",
+		"recipes/old.rb":         "removed",
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected file changes %v", changes)
+	}
+	for _, change := range diff.Files {
+		if change.Path == "recipes/default.rb" && change.Diff == "" {
+			t.Error("text file should have a unified diff")
+		}
+		if change.Path == "files/default/logo.png" && change.Diff != "" {
+			t.Error("binary file shouldn't have a unified diff")
+		}
+	}
+
+	expectedDeps := []DependencyChange{
+		{"iptables", ">= 0.0.0", "~> 2.0"},
+		{"logrotate", "", ">= 0.0.0"},
+	}
+	if !reflect.DeepEqual(diff.Dependencies, expectedDeps) {
+		t.Errorf("unexpected dependency changes %v", diff.Dependencies)
+	}
+	if len(diff.Metadata) != 1 || diff.Metadata[0].Field != "version" {
+		t.Errorf("unexpected metadata changes %v", diff.Metadata)
+	}
+}
@@ -0,0 +1,362 @@
+package chef
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// DefaultEncryptedDataBagSecretPath is where chef-client and knife look for
+// the encrypted data bag secret when encrypted_data_bag_secret isn't set
+const DefaultEncryptedDataBagSecretPath = "/etc/chef/encrypted_data_bag_secret"
+
+// ErrDataBagItemNotEncrypted is returned when decrypting a data bag item whose
+// values aren't encrypted
+var ErrDataBagItemNotEncrypted = errors.New("data bag item isn't encrypted")
+
+// chef.ReadEncryptedDataBagSecret reads a shared secret file, such as the one
+// knife's encrypted_data_bag_secret setting points to. Leading and trailing
+// whitespace is stripped, just like Chef does.
+func ReadEncryptedDataBagSecret(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(content), nil
+}
+
+// chef.EncryptedDataBagSecret reads the shared secret file set with the
+// encrypted_data_bag_secret setting of the knife.rb used to connect, or the
+// default /etc/chef/encrypted_data_bag_secret one.
+//
+// Usage:
+//
+//     secret, err := chef.EncryptedDataBagSecret()
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     item, ok, err := chef.GetEncryptedDataBagItem("passwords", "mysql", secret)
+func (chef *Chef) EncryptedDataBagSecret() ([]byte, error) {
+	path := chef.EncryptedDataBagSecretPath
+	if path == "" {
+		path = DefaultEncryptedDataBagSecretPath
+	}
+	return ReadEncryptedDataBagSecret(path)
+}
+
+// chef.EncryptedDataBagItemVersion returns the encryption format version of a
+// data bag item, 1, 2 or 3, as found in its encrypted values. It returns
+// ErrDataBagItemNotEncrypted if the item has no encrypted value.
+func EncryptedDataBagItemVersion(item DataBagItem) (int, error) {
+	for _, key := range dataBagItemKeys(item) {
+		if key == "id" {
+			continue
+		}
+		version, ok := encryptedValueVersion(item[key])
+		if !ok {
+			return 0, ErrDataBagItemNotEncrypted
+		}
+		return version, nil
+	}
+	return 0, ErrDataBagItemNotEncrypted
+}
+
+// dataBagItemKeys returns the sorted keys of an item
+func dataBagItemKeys(item DataBagItem) []string {
+	keys := map[string]string{}
+	for key := range item {
+		keys[key] = key
+	}
+	return sortedKeys(keys)
+}
+
+// encryptedValueVersion returns the format version of an encrypted value, and
+// false if the value isn't encrypted
+func encryptedValueVersion(value interface{}) (int, bool) {
+	encrypted, ok := value.(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+	if _, ok := encrypted["encrypted_data"].(string); !ok {
+		return 0, false
+	}
+	// a float64 once decoded from JSON, an int as created by
+	// chef.EncryptDataBagItem
+	switch version := encrypted["version"].(type) {
+	case float64:
+		return int(version), true
+	case int:
+		return version, true
+	}
+	// items encrypted before Chef 11 have no version and can't be read
+	return 0, true
+}
+
+// chef.DecryptDataBagItem decrypts every value of an encrypted data bag item,
+// except for its id, with the shared secret. The format version of each value
+// is detected, and version 2 values have their HMAC checked, so a wrong
+// secret is reported as an error.
+//
+// Usage:
+//
+//     encrypted, _, _ := chef.GetDataBagItem("passwords", "mysql")
+//     item, err := chef.DecryptDataBagItem(encrypted, secret)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println(item["root"])
+func DecryptDataBagItem(item DataBagItem, secret []byte) (DataBagItem, error) {
+	if _, err := EncryptedDataBagItemVersion(item); err != nil {
+		return nil, err
+	}
+	decrypted := DataBagItem{}
+	for key, value := range item {
+		if key == "id" {
+			decrypted[key] = value
+			continue
+		}
+		plain, err := decryptDataBagValue(value, secret)
+		if err != nil {
+			return nil, fmt.Errorf("data bag item %s, key %s: %s", item.ID(), key, err)
+		}
+		decrypted[key] = plain
+	}
+	return decrypted, nil
+}
+
+// chef.EncryptDataBagItem encrypts every value of a data bag item, except for
+// its id, with the shared secret using the given format version: 1 for
+// AES-256-CBC, 2 for AES-256-CBC with an HMAC, or 3 for AES-256-GCM. The
+// result can be read by chef-client and knife.
+//
+// Usage:
+//
+//     item := chef.DataBagItem{"id": "mysql", "root": "s3cr3t"}
+//     encrypted, err := chef.EncryptDataBagItem(item, secret, 3)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     err = chef.CreateDataBagItem("passwords", encrypted)
+func EncryptDataBagItem(item DataBagItem, secret []byte, version int) (DataBagItem, error) {
+	if err := validateDataBagItem(item); err != nil {
+		return nil, err
+	}
+	encrypted := DataBagItem{}
+	for key, value := range item {
+		if key == "id" {
+			encrypted[key] = value
+			continue
+		}
+		value, err := encryptDataBagValue(value, secret, version)
+		if err != nil {
+			return nil, fmt.Errorf("data bag item %s, key %s: %s", item.ID(), key, err)
+		}
+		encrypted[key] = value
+	}
+	return encrypted, nil
+}
+
+// chef.GetEncryptedDataBagItem returns the decrypted item with the given id
+// from the given data bag, a bool indicating whether or not the item was found
+// and an error indicating if the request or the decryption failed.
+//
+// Usage:
+//
+//     item, ok, err := chef.GetEncryptedDataBagItem("passwords", "mysql", secret)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     if ok {
+//         fmt.Println(item["root"])
+//     }
+func (chef *Chef) GetEncryptedDataBagItem(bag, id string, secret []byte) (DataBagItem, bool, error) {
+	item, ok, err := chef.GetDataBagItem(bag, id)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	decrypted, err := DecryptDataBagItem(item, secret)
+	if err != nil {
+		return nil, false, err
+	}
+	return decrypted, true, nil
+}
+
+// decryptDataBagValue decrypts a single encrypted value
+func decryptDataBagValue(value interface{}, secret []byte) (interface{}, error) {
+	version, ok := encryptedValueVersion(value)
+	if !ok {
+		return nil, errors.New("value isn't encrypted")
+	}
+	encrypted := value.(map[string]interface{})
+	field := func(name string) ([]byte, error) {
+		s, ok := encrypted[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing %s", name)
+		}
+		return base64.StdEncoding.DecodeString(s)
+	}
+	key := sha256.Sum256(secret)
+
+	data, err := field("encrypted_data")
+	if err != nil {
+		return nil, err
+	}
+	iv, err := field("iv")
+	if err != nil {
+		return nil, err
+	}
+
+	var plain []byte
+	switch version {
+	case 1, 2:
+		if version == 2 {
+			expected, err := field("hmac")
+			if err != nil {
+				return nil, err
+			}
+			// the HMAC is computed over the base64 encoded data, as stored
+			mac := hmac.New(sha256.New, secret)
+			mac.Write([]byte(encrypted["encrypted_data"].(string)))
+			if !hmac.Equal(mac.Sum(nil), expected) {
+				return nil, errors.New("HMAC doesn't match, the secret is probably wrong")
+			}
+		}
+		plain, err = decryptCBC(key[:], iv, data)
+		if err != nil {
+			return nil, err
+		}
+	case 3:
+		tag, err := field("auth_tag")
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+		if err != nil {
+			return nil, err
+		}
+		plain, err = gcm.Open(nil, iv, append(data, tag...), nil)
+		if err != nil {
+			return nil, errors.New("decryption failed, the secret is probably wrong")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encrypted data bag format version %d", version)
+	}
+
+	var wrapper struct {
+		Value interface{} `json:"json_wrapper"`
+	}
+	if err := json.Unmarshal(plain, &wrapper); err != nil {
+		return nil, errors.New("decryption failed, the secret is probably wrong")
+	}
+	return wrapper.Value, nil
+}
+
+// decryptCBC decrypts AES-256-CBC data and removes its PKCS#7 padding
+func decryptCBC(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted data")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errors.New("decryption failed, the secret is probably wrong")
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("decryption failed, the secret is probably wrong")
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// encryptDataBagValue encrypts a single value the way Chef does: the value is
+// wrapped in a {"json_wrapper": value} object, encrypted, and the binary
+// fields are base64 encoded with Ruby's Base64.encode64 line breaks
+func encryptDataBagValue(value interface{}, secret []byte, version int) (map[string]interface{}, error) {
+	plain, err := json.Marshal(map[string]interface{}{"json_wrapper": value})
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := map[string]interface{}{"version": version}
+	switch version {
+	case 1, 2:
+		iv := make([]byte, aes.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return nil, err
+		}
+		padding := aes.BlockSize - len(plain)%aes.BlockSize
+		plain = append(plain, bytes.Repeat([]byte{byte(padding)}, padding)...)
+		data := make([]byte, len(plain))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, plain)
+
+		encrypted["encrypted_data"] = encode64(data)
+		encrypted["iv"] = encode64(iv)
+		encrypted["cipher"] = "aes-256-cbc"
+		if version == 2 {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write([]byte(encrypted["encrypted_data"].(string)))
+			encrypted["hmac"] = encode64(mac.Sum(nil))
+		}
+	case 3:
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		iv := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(iv); err != nil {
+			return nil, err
+		}
+		sealed := gcm.Seal(nil, iv, plain, nil)
+		data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+		encrypted["encrypted_data"] = encode64(data)
+		encrypted["iv"] = encode64(iv)
+		encrypted["auth_tag"] = encode64(tag)
+		encrypted["cipher"] = "aes-256-gcm"
+	default:
+		return nil, fmt.Errorf("unsupported encrypted data bag format version %d", version)
+	}
+	return encrypted, nil
+}
+
+// encode64 base64 encodes data like Ruby's Base64.encode64, with a line break
+// every 60 characters and at the end
+func encode64(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var lines strings.Builder
+	for len(encoded) > 60 {
+		lines.WriteString(encoded[:60] + "\n")
+		encoded = encoded[60:]
+	}
+	lines.WriteString(encoded + "\n")
+	return lines.String()
+}
@@ -0,0 +1,143 @@
+package chef
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// The items in test/support/encrypted_data_bag follow the format written by
+// Chef::EncryptedDataBagItem::Encryptor: values wrapped in {"json_wrapper":
+// ...}, keys derived with SHA-256 from the secret, Base64.encode64 line breaks
+// and, for version 2, an HMAC of the base64 encoded data. They are meant to be
+// encrypted by Chef itself with test/support/regen_encrypted_data_bag.sh,
+// which records the Ruby and Chef versions used in VERSIONS. Until it is run,
+// the checked in items are the ones encrypted with OpenSSL, independently of
+// this package.
+func readTestEncryptedItem(t *testing.T, version int) DataBagItem {
+	content, err := ioutil.ReadFile(fmt.Sprintf("test/support/encrypted_data_bag/mysql_v%d.json", version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := DataBagItem{}
+	if err := json.Unmarshal(content, &item); err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func TestDecryptDataBagItem(t *testing.T) {
+	secret, err := ReadEncryptedDataBagSecret("test/support/encrypted_data_bag/secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != "chef_golang_test_secret" {
+		t.Fatalf("secret wasn't stripped: %q", secret)
+	}
+
+	expected := DataBagItem{
+		"id":       "mysql",
+		"password": "s3cr3t",
+		"database": map[string]interface{}{"user": "root", "port": float64(3306)},
+	}
+	for _, version := range []int{1, 2, 3} {
+		encrypted := readTestEncryptedItem(t, version)
+		if v, err := EncryptedDataBagItemVersion(encrypted); err != nil || v != version {
+			t.Errorf("detected version %d instead of %d: %v", v, version, err)
+		}
+
+		item, err := DecryptDataBagItem(encrypted, secret)
+		if err != nil {
+			t.Errorf("version %d: %s", version, err)
+			continue
+		}
+		if !reflect.DeepEqual(item, expected) {
+			t.Errorf("version %d: unexpected item %v", version, item)
+		}
+
+		if _, err := DecryptDataBagItem(encrypted, []byte("wrong secret")); err == nil {
+			t.Errorf("version %d: a wrong secret should be reported", version)
+		}
+	}
+}
+
+func TestDecryptTamperedDataBagItem(t *testing.T) {
+	item := readTestEncryptedItem(t, 2)
+	// swap the encrypted data of two values without updating their HMACs
+	password := item["password"].(map[string]interface{})
+	database := item["database"].(map[string]interface{})
+	password["encrypted_data"], database["encrypted_data"] = database["encrypted_data"], password["encrypted_data"]
+	if _, err := DecryptDataBagItem(item, []byte("chef_golang_test_secret")); err == nil {
+		t.Error("tampered data should fail the HMAC check")
+	}
+}
+
+func TestEncryptDataBagItem(t *testing.T) {
+	secret := []byte("another secret")
+	item := DataBagItem{
+		"id":    "app",
+		"token": "abc",
+		"hosts": []interface{}{"a", "b"},
+		"long":  string(make([]byte, 100)),
+	}
+	for _, version := range []int{1, 2, 3} {
+		encrypted, err := EncryptDataBagItem(item, secret, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// go through JSON, as when the item is stored on the server
+		data, _ := json.Marshal(encrypted)
+		stored := DataBagItem{}
+		json.Unmarshal(data, &stored)
+
+		if v, _ := EncryptedDataBagItemVersion(stored); v != version {
+			t.Errorf("detected version %d instead of %d", v, version)
+		}
+		decrypted, err := DecryptDataBagItem(stored, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decrypted, item) {
+			t.Errorf("version %d: round trip changed the item: %v", version, decrypted)
+		}
+	}
+
+	if _, err := EncryptDataBagItem(item, secret, 4); err == nil {
+		t.Error("unknown versions should be refused")
+	}
+	if _, err := DecryptDataBagItem(item, secret); err != ErrDataBagItemNotEncrypted {
+		t.Error("plain items should be reported as not encrypted")
+	}
+}
+
+func TestEncryptDecryptDataBagItemDirectly(t *testing.T) {
+	secret := []byte("another secret")
+	item := DataBagItem{"id": "app", "token": "abc", "hosts": []interface{}{"a", "b"}}
+	for _, version := range []int{1, 2, 3} {
+		encrypted, err := EncryptDataBagItem(item, secret, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// no JSON round trip: the version is still an int
+		if v, err := EncryptedDataBagItemVersion(encrypted); v != version || err != nil {
+			t.Errorf("detected version %d instead of %d: %v", v, version, err)
+		}
+		decrypted, err := DecryptDataBagItem(encrypted, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decrypted, item) {
+			t.Errorf("version %d: round trip changed the item: %v", version, decrypted)
+		}
+	}
+}
+
+func TestEncode64(t *testing.T) {
+	encoded := encode64(make([]byte, 50))
+	expected := "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\nAAAAAAA=\n"
+	if encoded != expected {
+		t.Errorf("unexpected encoding %q", encoded)
+	}
+}
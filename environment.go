@@ -1,9 +1,12 @@
 package chef
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"net/http"
 )
 
 // chef.Environment dinfes the relevant parameters of a Chef environment. This
@@ -79,7 +82,7 @@ func (chef *Chef) GetEnvironment(name string) (*Environment, bool, error) {
 	}
 	body, err := responseBody(resp)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
+		if hasStatus(err, http.StatusNotFound) {
 			return nil, false, nil
 		}
 		return nil, false, err
@@ -123,6 +126,27 @@ func (chef *Chef) GetEnvironmentCookbooks(name string) (map[string]*Cookbook, er
 	return cookbooks, nil
 }
 
+// chef.GetEnvironmentCookbooksWithVersions is similar to
+// chef.GetEnvironmentCookbooks, but lists up to numVersions versions of each
+// cookbook available in the environment instead of only the latest one. Pass
+// chef.AllVersions to list every version.
+//
+// Usage:
+//
+//     cookbooks, err := chef.GetEnvironmentCookbooksWithVersions("production", 3)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for name, cookbook := range cookbooks {
+//         for _, version := range cookbook.Versions {
+//             fmt.Println(name, version.Version)
+//         }
+//     }
+func (chef *Chef) GetEnvironmentCookbooksWithVersions(name string, numVersions int) (map[string]*Cookbook, error) {
+	return chef.getCookbookList(fmt.Sprintf("environments/%s/cookbooks", name), numVersions)
+}
+
 // chef.GetEnvironmentCookbook accepts a string which represents the name of a
 // Chef environment as well as a string which represent the name of a cookbook
 // and returns a *Chef.Cookbook type, a bool indicating whether or not the
@@ -150,7 +174,7 @@ func (chef *Chef) GetEnvironmentCookbook(env, cb string) (*Cookbook, bool, error
 	}
 	body, err := responseBody(resp)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
+		if hasStatus(err, http.StatusNotFound) {
 			return nil, false, nil
 		}
 		return nil, false, err
@@ -228,13 +252,18 @@ func (chef *Chef) GetEnvironmentRecipes(name string) ([]string, error) {
 	return recipes, nil
 }
 
+// chef.EnvironmentRole is the run list a role applies in an environment, as
+// returned by chef.GetEnvironmentRole
+type EnvironmentRole struct {
+	RunList []string `json:"run_list"`
+}
+
 // chef.GetEnvironmentRole accepts a string which represents the name of a
 // Chef environment as well as a string which represent the name of a role
-// and returns a map of strings (which represent a role attribute like a
-// runlist) to a slice of strings which represents the relevant information with
-// regards to that attribute, a bool indicating whether or not the role was
-// found in the given environment as well as an error indicating whether or not
-// the request failed.
+// and returns a pointer to a chef.EnvironmentRole holding the role's run list
+// in that environment, a bool indicating whether or not the role was found in
+// the given environment as well as an error indicating whether or not the
+// request failed.
 //
 // Usage:
 //
@@ -246,24 +275,161 @@ func (chef *Chef) GetEnvironmentRecipes(name string) ([]string, error) {
 //     if !ok {
 //         fmt.Println("Couldn't find that role!")
 //     } else {
-//         // do what you please with the "role" variable
-//         fmt.Println(role)
+//         fmt.Println(role.RunList)
 //     }
-func (chef *Chef) GetEnvironmentRole(env, rol string) (map[string][]string, bool, error) {
+func (chef *Chef) GetEnvironmentRole(env, rol string) (*EnvironmentRole, bool, error) {
 	resp, err := chef.Get(fmt.Sprintf("environments/%s/roles/%s", env, rol))
 	if err != nil {
 		return nil, false, err
 	}
 	body, err := responseBody(resp)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
+		if hasStatus(err, http.StatusNotFound) {
 			return nil, false, nil
 		}
 		return nil, false, err
 	}
 
-	role := map[string][]string{}
-	json.Unmarshal(body, &role)
+	role := new(EnvironmentRole)
+	json.Unmarshal(body, role)
 
 	return role, true, nil
 }
+
+// chef.ErrDefaultEnvironment is returned when trying to modify the _default
+// environment, which the Chef server doesn't allow
+var ErrDefaultEnvironment = errors.New("the _default environment can't be modified")
+
+// chef.CreateEnvironment creates a new environment on the server from the
+// supplied *chef.Environment type. The json_class and chef_type fields are set
+// for you.
+//
+// Usage:
+//
+//     environment := &chef.Environment{
+//         Name:             "staging",
+//         CookbookVersions: map[string]string{"apache2": "= 1.10.2"},
+//     }
+//     err := chef.CreateEnvironment(environment)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) CreateEnvironment(env *Environment) error {
+	if env.Name == "_default" {
+		return ErrDefaultEnvironment
+	}
+	payload, err := environmentPayload(env)
+	if err != nil {
+		return err
+	}
+	resp, err := chef.Post("environments", "application/json", nil, payload)
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// chef.UpdateEnvironment reads the environment with the given name, hands it
+// to the supplied function to be modified, and writes the result back to the
+// server. This is the way to change an environment's cookbook version pins or
+// attributes without losing the rest of it. The updated environment is
+// returned. If the function returns an error, nothing is written.
+//
+// Usage:
+//
+//     environment, err := chef.UpdateEnvironment("production", func(env *chef.Environment) error {
+//         env.CookbookVersions["apache2"] = "= 1.10.2"
+//         env.OverrideAttributes["apache"] = map[string]interface{}{"listen_ports": []string{"80"}}
+//         return nil
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) UpdateEnvironment(name string, update func(*Environment) error) (*Environment, error) {
+	if name == "_default" {
+		return nil, ErrDefaultEnvironment
+	}
+	env, ok, err := chef.GetEnvironment(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("environment %s not found", name)
+	}
+	if env.CookbookVersions == nil {
+		env.CookbookVersions = map[string]string{}
+	}
+	if env.DefaultAttributes == nil {
+		env.DefaultAttributes = map[string]interface{}{}
+	}
+	if env.OverrideAttributes == nil {
+		env.OverrideAttributes = map[string]interface{}{}
+	}
+
+	if err := update(env); err != nil {
+		return nil, err
+	}
+	if env.Name == "_default" {
+		return nil, ErrDefaultEnvironment
+	}
+
+	payload, err := environmentPayload(env)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chef.Put(fmt.Sprintf("environments/%s", name), nil, payload)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := responseBody(resp); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// chef.DeleteEnvironment deletes the environment with the given name from the
+// server.
+//
+// Usage:
+//
+//     err := chef.DeleteEnvironment("staging")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) DeleteEnvironment(name string) error {
+	if name == "_default" {
+		return ErrDefaultEnvironment
+	}
+	resp, err := chef.Delete(fmt.Sprintf("environments/%s", name), nil)
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// environmentPayload returns the JSON representation of an environment the
+// way the server expects it
+func environmentPayload(env *Environment) (io.Reader, error) {
+	payload := *env
+	payload.JSONClass = "Chef::Environment"
+	payload.ChefType = "environment"
+	if payload.CookbookVersions == nil {
+		payload.CookbookVersions = map[string]string{}
+	}
+	if payload.DefaultAttributes == nil {
+		payload.DefaultAttributes = map[string]interface{}{}
+	}
+	if payload.OverrideAttributes == nil {
+		payload.OverrideAttributes = map[string]interface{}{}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(body), nil
+}
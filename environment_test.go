@@ -89,5 +89,68 @@ func TestGetEnvironmentRole(t *testing.T) {
 	if !ok {
 		t.Error("Couldn't find required role in required environment")
 	}
-	t.Log(test)
+	t.Log(test.RunList)
+}
+
+func TestGetEnvironmentCookbooksWithVersions(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	cookbooks, err := chef.GetEnvironmentCookbooksWithVersions(config.RequiredEnvironment.Name, AllVersions)
+	if err != nil {
+		t.Error(err)
+	}
+	if cookbooks[config.RequiredCookbook.Name] == nil {
+		t.Error("Couldn't find cookbook in environment")
+	}
+}
+
+func TestEnvironmentCRUD(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	name := "chef_golang_test"
+
+	err := chef.CreateEnvironment(&Environment{Name: name, Description: "created by the tests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chef.DeleteEnvironment(name)
+
+	_, err = chef.UpdateEnvironment(name, func(env *Environment) error {
+		env.CookbookVersions[config.RequiredCookbook.Name] = "= " + config.RequiredCookbook.Version
+		env.DefaultAttributes["chef_golang"] = "test"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, ok, err := chef.GetEnvironment(name)
+	if err != nil || !ok {
+		t.Fatal("Couldn't find updated environment", err)
+	}
+	if env.CookbookVersions[config.RequiredCookbook.Name] != "= "+config.RequiredCookbook.Version {
+		t.Error("Cookbook version pin wasn't updated")
+	}
+	if env.Description != "created by the tests" {
+		t.Error("Update lost the environment's description")
+	}
+
+	if err := chef.DeleteEnvironment(name); err != nil {
+		t.Error(err)
+	}
+	if _, ok, _ := chef.GetEnvironment(name); ok {
+		t.Error("Environment wasn't deleted")
+	}
+}
+
+func TestDefaultEnvironmentIsProtected(t *testing.T) {
+	// refused before any request is made, so no server is needed
+	chef := &Chef{}
+	if err := chef.DeleteEnvironment("_default"); err != ErrDefaultEnvironment {
+		t.Error("Deleting _default should be refused")
+	}
+	_, err := chef.UpdateEnvironment("_default", func(env *Environment) error { return nil })
+	if err != ErrDefaultEnvironment {
+		t.Error("Updating _default should be refused")
+	}
 }
@@ -0,0 +1,151 @@
+package chef
+
+import (
+	"fmt"
+	"sort"
+)
+
+// chef.PinImpactReport describes how changing an environment's cookbook
+// version pins would affect the nodes of that environment
+type PinImpactReport struct {
+	Environment string
+	Nodes       []*NodeImpact
+}
+
+// chef.NodeImpact describes how a pin change affects a single node: which
+// cookbooks it would get a different version of, which recipes of its run list
+// come from those cookbooks, and whether its run list can still be solved.
+// CurrentError and ProposedError hold the resolution failures with the
+// current and the proposed pins respectively.
+type NodeImpact struct {
+	Node          string
+	Changes       []CookbookVersionChange
+	Recipes       []string
+	CurrentError  error
+	ProposedError error
+}
+
+// chef.CookbookVersionChange is a cookbook whose resolved version changes. An
+// empty version means the cookbook isn't part of that solution.
+type CookbookVersionChange struct {
+	Cookbook string
+	Current  string
+	Proposed string
+}
+
+// Affected returns the nodes which would get a different set of cookbooks or
+// which would fail to solve their run list
+func (r *PinImpactReport) Affected() []*NodeImpact {
+	affected := []*NodeImpact{}
+	for _, node := range r.Nodes {
+		if len(node.Changes) > 0 || node.ProposedError != nil {
+			affected = append(affected, node)
+		}
+	}
+	return affected
+}
+
+// chef.AnalyzePinChanges re-resolves the expanded run list of every node,
+// given as a map of node names to the recipes returned by chef.ExpandRunList,
+// with both the environment's current pins and the proposed ones, and reports
+// the difference for each node.
+func AnalyzePinChanges(solver *Depsolver, env *Environment, proposed map[string]string, runLists map[string][]string) *PinImpactReport {
+	report := &PinImpactReport{Environment: env.Name}
+
+	names := []string{}
+	for name := range runLists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		runList := runLists[name]
+		impact := &NodeImpact{Node: name}
+		report.Nodes = append(report.Nodes, impact)
+
+		var current, next map[string]string
+		current, impact.CurrentError = solver.Solve(runList, env.CookbookVersions)
+		next, impact.ProposedError = solver.Solve(runList, proposed)
+		if impact.CurrentError != nil || impact.ProposedError != nil {
+			continue
+		}
+
+		changed := map[string]bool{}
+		for _, cookbook := range sortedKeys(current, next) {
+			if current[cookbook] != next[cookbook] {
+				changed[cookbook] = true
+				impact.Changes = append(impact.Changes, CookbookVersionChange{
+					Cookbook: cookbook,
+					Current:  current[cookbook],
+					Proposed: next[cookbook],
+				})
+			}
+		}
+		for _, recipe := range runList {
+			cookbook, _, err := runListCookbook(recipe)
+			if err == nil && changed[cookbook] {
+				impact.Recipes = append(impact.Recipes, recipe)
+			}
+		}
+	}
+	return report
+}
+
+// chef.AnalyzeEnvironmentPinChanges reports how replacing the cookbook version
+// pins of the named environment with the proposed ones would affect each of
+// the environment's nodes. Cookbook dependencies are loaded from /universe and
+// the nodes' run lists are expanded with the server's roles, using their
+// run lists for the environment.
+//
+// Usage:
+//
+//     proposed := map[string]string{"apache2": "= 2.0.0"}
+//     report, err := chef.AnalyzeEnvironmentPinChanges("production", proposed)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, node := range report.Affected() {
+//         if node.ProposedError != nil {
+//             fmt.Println(node.Node, "would fail:", node.ProposedError)
+//             continue
+//         }
+//         for _, change := range node.Changes {
+//             fmt.Println(node.Node, change.Cookbook, change.Current, "->", change.Proposed)
+//         }
+//     }
+func (chef *Chef) AnalyzeEnvironmentPinChanges(envName string, proposed map[string]string) (*PinImpactReport, error) {
+	env, ok, err := chef.GetEnvironment(envName)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("environment %s not found", envName)
+	}
+	nodes, err := chef.GetEnvironmentNodes(envName)
+	if err != nil {
+		return nil, err
+	}
+
+	runLists := map[string][]string{}
+	expander := newRunListExpander(chef.GetRole, envName)
+	for name := range nodes {
+		node, ok, err := chef.GetNode(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		runLists[name], err = expander.expand(node.RunList)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	solver, err := chef.NewDepsolverFromUniverse()
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzePinChanges(solver, env, proposed, runLists), nil
+}
@@ -0,0 +1,55 @@
+package chef
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzePinChanges(t *testing.T) {
+	solver := testDepsolver(t)
+	env := &Environment{
+		Name:             "production",
+		CookbookVersions: map[string]string{"iptables": "= 1.5.0"},
+	}
+	proposed := map[string]string{"iptables": "= 2.1.0", "logrotate": "= 0.9.0"}
+	runLists := map[string][]string{
+		"db1":  {"mysql"},
+		"idle": {},
+		"web1": {"apache2::mod_ssl", "logrotate"},
+		"web2": {"recipe[iptables]"},
+	}
+
+	report := AnalyzePinChanges(solver, env, proposed, runLists)
+	if report.Environment != "production" || len(report.Nodes) != 4 {
+		t.Fatalf("unexpected report %v", report.Nodes)
+	}
+	db1, idle, web1, web2 := report.Nodes[0], report.Nodes[1], report.Nodes[2], report.Nodes[3]
+
+	if db1.CurrentError == nil || db1.ProposedError == nil {
+		t.Error("mysql depends on a missing cookbook, db1 can't be solved")
+	}
+	if idle.CurrentError != nil || idle.ProposedError != nil || len(idle.Changes) > 0 {
+		t.Errorf("unexpected impact on an empty run list %v", idle)
+	}
+
+	// logrotate 0.9.0 needs iptables < 2.0
+	if web1.CurrentError != nil || web1.ProposedError == nil {
+		t.Errorf("unexpected errors for web1: %v, %v", web1.CurrentError, web1.ProposedError)
+	}
+
+	if web2.CurrentError != nil || web2.ProposedError != nil {
+		t.Fatal(web2.CurrentError, web2.ProposedError)
+	}
+	expected := []CookbookVersionChange{{"iptables", "1.5.0", "2.1.0"}}
+	if !reflect.DeepEqual(web2.Changes, expected) {
+		t.Errorf("unexpected changes for web2: %v", web2.Changes)
+	}
+	if !reflect.DeepEqual(web2.Recipes, []string{"recipe[iptables]"}) {
+		t.Errorf("unexpected recipes for web2: %v", web2.Recipes)
+	}
+
+	affected := report.Affected()
+	if len(affected) != 3 || affected[1] != web1 {
+		t.Errorf("unexpected affected nodes %v", affected)
+	}
+}
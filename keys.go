@@ -0,0 +1,449 @@
+package chef
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// chef.KeyExpiration is the expiration date of a client or user key. The zero
+// value is a key which never expires, "infinity" for the Chef server.
+type KeyExpiration struct {
+	time.Time
+}
+
+// keyExpirationFormat is the format the Chef server uses for expiration dates
+const keyExpirationFormat = "2006-01-02T15:04:05Z"
+
+// NeverExpires returns a key expiration which never comes
+func NeverExpires() KeyExpiration {
+	return KeyExpiration{}
+}
+
+// ExpiresAt returns a key expiration at the given time. The Chef server only
+// keeps whole seconds.
+func ExpiresAt(t time.Time) KeyExpiration {
+	return KeyExpiration{t.UTC().Truncate(time.Second)}
+}
+
+// Infinite returns whether or not the key never expires
+func (e KeyExpiration) Infinite() bool {
+	return e.IsZero()
+}
+
+// Expired returns whether or not the key has expired at the given time
+func (e KeyExpiration) Expired(now time.Time) bool {
+	return !e.Infinite() && !now.Before(e.Time)
+}
+
+// String returns the expiration in the form the Chef server uses, such as
+// "2026-12-24T21:00:00Z" or "infinity"
+func (e KeyExpiration) String() string {
+	if e.Infinite() {
+		return "infinity"
+	}
+	return e.UTC().Format(keyExpirationFormat)
+}
+
+// MarshalJSON encodes the expiration as the Chef server expects it
+func (e KeyExpiration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.String())
+}
+
+// UnmarshalJSON decodes an expiration date or "infinity"
+func (e *KeyExpiration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == "" || s == "infinity" {
+		*e = NeverExpires()
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return fmt.Errorf("invalid key expiration date '%s'", s)
+	}
+	*e = ExpiresAt(t)
+	return nil
+}
+
+// chef.KeyInfo describes a key as listed by chef.GetClientKeys and
+// chef.GetUserKeys
+type KeyInfo struct {
+	Name    string `json:"name"`
+	URI     string `json:"uri"`
+	Expired bool   `json:"expired"`
+}
+
+// chef.Key is a named public key of a client or user. A client or user can
+// have several keys at once, and can authenticate with any of them until it
+// expires.
+type Key struct {
+	Name           string        `json:"name"`
+	PublicKey      string        `json:"public_key"`
+	ExpirationDate KeyExpiration `json:"expiration_date"`
+}
+
+// chef.GetClientKeys returns the keys of the client with the given name, sorted
+// by name.
+//
+// Usage:
+//
+//     keys, err := chef.GetClientKeys("web1.example.com")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, key := range keys {
+//         fmt.Println(key.Name, key.Expired)
+//     }
+func (chef *Chef) GetClientKeys(client string) ([]KeyInfo, error) {
+	return chef.getKeys(fmt.Sprintf("clients/%s/keys", client))
+}
+
+// chef.GetClientKey returns the key with the given name of a client, a bool
+// indicating whether or not the key was found and an error indicating if the
+// request failed or not.
+//
+// Usage:
+//
+//     key, ok, err := chef.GetClientKey("web1.example.com", "default")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     if ok {
+//         fmt.Println(key.ExpirationDate)
+//     }
+func (chef *Chef) GetClientKey(client, name string) (*Key, bool, error) {
+	return chef.getKey(fmt.Sprintf("clients/%s/keys", client), name)
+}
+
+// chef.CreateClientKey adds a key to a client. If the key has no PublicKey,
+// the server generates a key pair and its private key is returned; it isn't
+// kept by the server and must be saved right away. Adding the new key before
+// deleting the old one rotates a client's key without downtime.
+//
+// Usage:
+//
+//     privateKey, err := chef.CreateClientKey("web1.example.com", &chef.Key{
+//         Name:           "2026",
+//         ExpirationDate: chef.ExpiresAt(time.Now().AddDate(1, 0, 0)),
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     // deploy the new key to the client, then
+//     err = chef.DeleteClientKey("web1.example.com", "default")
+func (chef *Chef) CreateClientKey(client string, key *Key) (string, error) {
+	return chef.createKey(fmt.Sprintf("clients/%s/keys", client), key)
+}
+
+// chef.UpdateClientKey reads the key with the given name of a client, hands it
+// to the supplied function to be modified, and writes the result back to the
+// server. The name, public key and expiration date can be changed. The updated
+// key is returned. If the function returns an error, nothing is written.
+//
+// Usage:
+//
+//     key, err := chef.UpdateClientKey("web1.example.com", "default", func(key *chef.Key) error {
+//         key.ExpirationDate = chef.ExpiresAt(time.Now().AddDate(0, 0, 7))
+//         return nil
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) UpdateClientKey(client, name string, update func(*Key) error) (*Key, error) {
+	return chef.updateKey(fmt.Sprintf("clients/%s/keys", client), name, update)
+}
+
+// chef.DeleteClientKey deletes the key with the given name of a client.
+//
+// Usage:
+//
+//     err := chef.DeleteClientKey("web1.example.com", "default")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) DeleteClientKey(client, name string) error {
+	return chef.deleteKey(fmt.Sprintf("clients/%s/keys", client), name)
+}
+
+// chef.GetExpiringClientKeys returns the keys of a client which expire within
+// the given window, including those which have already expired, sorted by
+// expiration date.
+//
+// Usage:
+//
+//     keys, err := chef.GetExpiringClientKeys("web1.example.com", 30*24*time.Hour)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, key := range keys {
+//         fmt.Println(key.Name, "expires on", key.ExpirationDate)
+//     }
+func (chef *Chef) GetExpiringClientKeys(client string, window time.Duration) ([]*Key, error) {
+	return chef.getExpiringKeys(fmt.Sprintf("clients/%s/keys", client), window)
+}
+
+// chef.GetUserKeys returns the keys of the user with the given name, sorted by
+// name. Users aren't part of an organization, so their keys are managed at
+// the root of the Chef server.
+//
+// Usage:
+//
+//     keys, err := chef.GetUserKeys("jdoe")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, key := range keys {
+//         fmt.Println(key.Name, key.Expired)
+//     }
+func (chef *Chef) GetUserKeys(user string) ([]KeyInfo, error) {
+	return chef.server().getKeys(fmt.Sprintf("users/%s/keys", user))
+}
+
+// chef.GetUserKey returns the key with the given name of a user, a bool
+// indicating whether or not the key was found and an error indicating if the
+// request failed or not.
+//
+// Usage:
+//
+//     key, ok, err := chef.GetUserKey("jdoe", "default")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     if ok {
+//         fmt.Println(key.ExpirationDate)
+//     }
+func (chef *Chef) GetUserKey(user, name string) (*Key, bool, error) {
+	return chef.server().getKey(fmt.Sprintf("users/%s/keys", user), name)
+}
+
+// chef.CreateUserKey adds a key to a user. If the key has no PublicKey, the
+// server generates a key pair and its private key is returned; it isn't kept
+// by the server and must be saved right away.
+//
+// Usage:
+//
+//     privateKey, err := chef.CreateUserKey("jdoe", &chef.Key{
+//         Name:      "laptop",
+//         PublicKey: publicKey,
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) CreateUserKey(user string, key *Key) (string, error) {
+	return chef.server().createKey(fmt.Sprintf("users/%s/keys", user), key)
+}
+
+// chef.UpdateUserKey reads the key with the given name of a user, hands it to
+// the supplied function to be modified, and writes the result back to the
+// server. The updated key is returned. If the function returns an error,
+// nothing is written.
+//
+// Usage:
+//
+//     key, err := chef.UpdateUserKey("jdoe", "laptop", func(key *chef.Key) error {
+//         key.ExpirationDate = chef.NeverExpires()
+//         return nil
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) UpdateUserKey(user, name string, update func(*Key) error) (*Key, error) {
+	return chef.server().updateKey(fmt.Sprintf("users/%s/keys", user), name, update)
+}
+
+// chef.DeleteUserKey deletes the key with the given name of a user.
+//
+// Usage:
+//
+//     err := chef.DeleteUserKey("jdoe", "laptop")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) DeleteUserKey(user, name string) error {
+	return chef.server().deleteKey(fmt.Sprintf("users/%s/keys", user), name)
+}
+
+// chef.GetExpiringUserKeys returns the keys of a user which expire within the
+// given window, including those which have already expired, sorted by
+// expiration date.
+//
+// Usage:
+//
+//     keys, err := chef.GetExpiringUserKeys("jdoe", 30*24*time.Hour)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) GetExpiringUserKeys(user string, window time.Duration) ([]*Key, error) {
+	return chef.server().getExpiringKeys(fmt.Sprintf("users/%s/keys", user), window)
+}
+
+// chef.ExpiringKeys returns the keys which expire before now plus the given
+// window, including those which have already expired, sorted by expiration
+// date. Keys which never expire are left out.
+func ExpiringKeys(keys []*Key, now time.Time, window time.Duration) []*Key {
+	expiring := []*Key{}
+	for _, key := range keys {
+		if key.ExpirationDate.Expired(now.Add(window)) {
+			expiring = append(expiring, key)
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].ExpirationDate.Before(expiring[j].ExpirationDate.Time)
+	})
+	return expiring
+}
+
+// getKeys lists the keys at the given endpoint
+func (chef *Chef) getKeys(endpoint string) ([]KeyInfo, error) {
+	resp, err := chef.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []KeyInfo{}
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+// getKey returns the key with the given name at the given endpoint
+func (chef *Chef) getKey(endpoint, name string) (*Key, bool, error) {
+	resp, err := chef.Get(fmt.Sprintf("%s/%s", endpoint, name))
+	if err != nil {
+		return nil, false, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		if hasStatus(err, http.StatusNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	key := new(Key)
+	if err := json.Unmarshal(body, key); err != nil {
+		return nil, false, err
+	}
+	return key, true, nil
+}
+
+// createKey adds a key at the given endpoint and returns the private key
+// generated by the server, if any
+func (chef *Chef) createKey(endpoint string, key *Key) (string, error) {
+	if key.Name == "" {
+		return "", fmt.Errorf("a key needs a name")
+	}
+	fields := map[string]interface{}{
+		"name":            key.Name,
+		"expiration_date": key.ExpirationDate,
+	}
+	if key.PublicKey != "" {
+		fields["public_key"] = key.PublicKey
+	} else {
+		fields["create_key"] = true
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	resp, err := chef.Post(endpoint, "application/json", nil, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return "", err
+	}
+
+	var response struct {
+		PrivateKey string `json:"private_key"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", err
+	}
+	return response.PrivateKey, nil
+}
+
+// updateKey modifies the key with the given name at the given endpoint
+func (chef *Chef) updateKey(endpoint, name string, update func(*Key) error) (*Key, error) {
+	key, ok, err := chef.getKey(endpoint, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", name)
+	}
+	if err := update(key); err != nil {
+		return nil, err
+	}
+	if key.Name == "" {
+		return nil, fmt.Errorf("a key needs a name")
+	}
+
+	payload, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chef.Put(fmt.Sprintf("%s/%s", endpoint, name), nil, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := responseBody(resp); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// deleteKey deletes the key with the given name at the given endpoint
+func (chef *Chef) deleteKey(endpoint, name string) error {
+	resp, err := chef.Delete(fmt.Sprintf("%s/%s", endpoint, name), nil)
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// getExpiringKeys reads every key at the given endpoint and returns those
+// which expire within the given window
+func (chef *Chef) getExpiringKeys(endpoint string, window time.Duration) ([]*Key, error) {
+	infos, err := chef.getKeys(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	keys := []*Key{}
+	for _, info := range infos {
+		key, ok, err := chef.getKey(endpoint, info.Name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	return ExpiringKeys(keys, time.Now(), window), nil
+}
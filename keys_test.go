@@ -0,0 +1,129 @@
+package chef
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyExpirationJSON(t *testing.T) {
+	var key Key
+	body := `{"name": "default", "public_key": "PUBLIC", "expiration_date": "2026-12-24T21:00:00Z"}`
+	if err := json.Unmarshal([]byte(body), &key); err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2026, 12, 24, 21, 0, 0, 0, time.UTC)
+	if key.ExpirationDate.Infinite() || !key.ExpirationDate.Equal(expected) {
+		t.Errorf("unexpected expiration %v", key.ExpirationDate)
+	}
+
+	if err := json.Unmarshal([]byte(`{"expiration_date": "infinity"}`), &key); err != nil {
+		t.Fatal(err)
+	}
+	if !key.ExpirationDate.Infinite() || key.ExpirationDate.Expired(time.Now()) {
+		t.Errorf("unexpected expiration %v", key.ExpirationDate)
+	}
+	if err := json.Unmarshal([]byte(`{"expiration_date": "tomorrow"}`), &key); err == nil {
+		t.Error("an invalid expiration date should be an error")
+	}
+
+	for expiration, expected := range map[KeyExpiration]string{
+		NeverExpires(): `"infinity"`,
+		ExpiresAt(time.Date(2026, 12, 24, 22, 0, 0, 5, time.FixedZone("CET", 3600))): `"2026-12-24T21:00:00Z"`,
+	} {
+		encoded, err := json.Marshal(expiration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(encoded) != expected {
+			t.Errorf("expected %s, got %s", expected, encoded)
+		}
+	}
+}
+
+func TestExpiringKeys(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	keys := []*Key{
+		{Name: "later", ExpirationDate: ExpiresAt(now.AddDate(0, 2, 0))},
+		{Name: "forever", ExpirationDate: NeverExpires()},
+		{Name: "soon", ExpirationDate: ExpiresAt(now.AddDate(0, 0, 10))},
+		{Name: "expired", ExpirationDate: ExpiresAt(now.AddDate(0, 0, -1))},
+	}
+	names := []string{}
+	for _, key := range ExpiringKeys(keys, now, 30*24*time.Hour) {
+		names = append(names, key.Name)
+	}
+	if strings.Join(names, " ") != "expired soon" {
+		t.Errorf("unexpected expiring keys %v", names)
+	}
+}
+
+func TestServer(t *testing.T) {
+	chef := &Chef{Url: "https://chef.example.com/organizations/acme", Organization: "acme"}
+	if url := chef.server().requestUrl("users"); url != "https://chef.example.com/users" {
+		t.Errorf("unexpected server url %s", url)
+	}
+	if chef.Url != "https://chef.example.com/organizations/acme" {
+		t.Error("the connection shouldn't be modified")
+	}
+}
+
+func TestClientKeyCRUD(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	name := "chef_golang_keys_test"
+
+	if _, err := chef.CreateClient(&Client{Name: name}); err != nil {
+		t.Fatal(err)
+	}
+	defer chef.DeleteClient(name)
+
+	privateKey, err := chef.CreateClientKey(name, &Key{
+		Name:           "rotated",
+		ExpirationDate: ExpiresAt(time.Now().Add(24 * time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(privateKey, "PRIVATE KEY") {
+		t.Error("Creating a key without a public key should return its private key")
+	}
+
+	keys, err := chef.GetClientKeys(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Name != "default" || keys[1].Name != "rotated" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	expiring, err := chef.GetExpiringClientKeys(name, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expiring) != 1 || expiring[0].Name != "rotated" {
+		t.Errorf("unexpected expiring keys %v", expiring)
+	}
+
+	_, err = chef.UpdateClientKey(name, "rotated", func(key *Key) error {
+		key.ExpirationDate = NeverExpires()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok, err := chef.GetClientKey(name, "rotated")
+	if err != nil || !ok {
+		t.Fatal("Couldn't find updated key", err)
+	}
+	if !key.ExpirationDate.Infinite() {
+		t.Errorf("Key wasn't updated: %v", key)
+	}
+
+	if err := chef.DeleteClientKey(name, "default"); err != nil {
+		t.Error(err)
+	}
+	if _, ok, _ := chef.GetClientKey(name, "default"); ok {
+		t.Error("Key wasn't deleted")
+	}
+}
@@ -0,0 +1,212 @@
+package chef
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// cookbookSegments lists the segments of a cookbook version, in the order Chef
+// lists them
+var cookbookSegments = []string{
+	"attributes",
+	"definitions",
+	"files",
+	"libraries",
+	"providers",
+	"recipes",
+	"resources",
+	"root_files",
+	"templates",
+}
+
+// chef.LoadCookbookVersion builds a *chef.CookbookVersion from a cookbook on
+// disk the same way knife does before uploading it: the metadata is read with
+// chef.ReadCookbookMetadata and every file which belongs to a cookbook segment
+// (recipes, templates, attributes, ...) is listed along with its checksum.
+// Files outside of the known segments are skipped, as well as files matching
+// the patterns of the cookbook's chefignore file or of the chefignore file in
+// the directory containing the cookbook.
+//
+// Usage:
+//
+//     cookbook, err := chef.LoadCookbookVersion("cookbooks/apache2")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, recipe := range cookbook.Recipes {
+//         fmt.Println(recipe.Path, recipe.Checksum)
+//     }
+func LoadCookbookVersion(dir string) (*CookbookVersion, error) {
+	metadata, err := ReadCookbookMetadata(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cookbook := new(CookbookVersion)
+	cookbook.Metadata = *metadata
+	cookbook.Name = metadata.Name
+	cookbook.Version = metadata.Version
+	cookbook.FullName = fmt.Sprintf("%s-%s", metadata.Name, metadata.Version)
+	cookbook.ChefType = "cookbook_version"
+	cookbook.JSONClass = "Chef::CookbookVersion"
+	cookbook.dir = dir
+
+	ignore := new(Chefignore)
+	if file := chefignoreFile(dir); file != "" {
+		if ignore, err = ReadChefignore(file); err != nil {
+			return nil, err
+		}
+	}
+
+	paths := []string{}
+	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			// don't bother walking directories such as .git or spec which
+			// can't hold any cookbook file
+			if rel != "." && !strings.Contains(rel, "/") && !isCookbookSegmentDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !ignore.Ignored(rel) {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	for _, rel := range paths {
+		segment, item, ok := cookbookItemForPath(rel)
+		if !ok {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		sum := md5.Sum(content)
+		item.Checksum = hex.EncodeToString(sum[:])
+		cookbook.addItem(segment, item)
+	}
+
+	return cookbook, nil
+}
+
+func isCookbookSegmentDir(name string) bool {
+	for _, segment := range cookbookSegments {
+		if segment == name && segment != "root_files" {
+			return true
+		}
+	}
+	return false
+}
+
+// cookbookItemForPath works out which segment a file belongs to from its path
+// relative to the cookbook's root, and what its name and specificity are
+func cookbookItemForPath(rel string) (string, CookbookItem, bool) {
+	item := CookbookItem{Path: rel, Specificity: "default"}
+	parts := strings.Split(rel, "/")
+	if len(parts) == 1 {
+		item.Name = rel
+		return "root_files", item, true
+	}
+
+	segment := parts[0]
+	rest := parts[1:]
+	switch segment {
+	case "attributes", "definitions", "recipes":
+		if len(rest) != 1 || !strings.HasSuffix(rel, ".rb") {
+			return "", item, false
+		}
+	case "libraries", "providers", "resources":
+		if !strings.HasSuffix(rel, ".rb") {
+			return "", item, false
+		}
+	case "files", "templates":
+		// files/<specificity>/<name>, or files/<name> for files which apply
+		// everywhere
+		if len(rest) == 1 {
+			item.Specificity = "root_default"
+		} else {
+			item.Specificity = rest[0]
+			rest = rest[1:]
+		}
+	default:
+		return "", item, false
+	}
+	item.Name = strings.Join(rest, "/")
+	return segment, item, true
+}
+
+// segmentItems returns the items of a segment of the cookbook version
+func (cookbook *CookbookVersion) segmentItems(segment string) []CookbookItem {
+	var list []struct{ CookbookItem }
+	switch segment {
+	case "attributes":
+		list = cookbook.Attributes
+	case "definitions":
+		list = cookbook.Definitions
+	case "files":
+		list = cookbook.Files
+	case "libraries":
+		list = cookbook.Libraries
+	case "providers":
+		list = cookbook.Providers
+	case "recipes":
+		list = cookbook.Recipes
+	case "resources":
+		list = cookbook.Resources
+	case "root_files":
+		list = cookbook.RootFiles
+	case "templates":
+		list = cookbook.Templates
+	}
+	items := make([]CookbookItem, len(list))
+	for i, entry := range list {
+		items[i] = entry.CookbookItem
+	}
+	return items
+}
+
+// addItem appends an item to a segment of the cookbook version
+func (cookbook *CookbookVersion) addItem(segment string, item CookbookItem) {
+	entry := struct{ CookbookItem }{item}
+	switch segment {
+	case "attributes":
+		cookbook.Attributes = append(cookbook.Attributes, entry)
+	case "definitions":
+		cookbook.Definitions = append(cookbook.Definitions, entry)
+	case "files":
+		cookbook.Files = append(cookbook.Files, entry)
+	case "libraries":
+		cookbook.Libraries = append(cookbook.Libraries, entry)
+	case "providers":
+		cookbook.Providers = append(cookbook.Providers, entry)
+	case "recipes":
+		cookbook.Recipes = append(cookbook.Recipes, entry)
+	case "resources":
+		cookbook.Resources = append(cookbook.Resources, entry)
+	case "root_files":
+		cookbook.RootFiles = append(cookbook.RootFiles, entry)
+	case "templates":
+		cookbook.Templates = append(cookbook.Templates, entry)
+	}
+}
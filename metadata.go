@@ -0,0 +1,445 @@
+package chef
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// chef.MetadataError is returned when a cookbook's metadata can't be read. For
+// metadata.rb files it points to the line holding the statement which couldn't
+// be evaluated.
+type MetadataError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *MetadataError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Message)
+}
+
+// chef.ReadCookbookMetadata reads the metadata of the cookbook found in the
+// supplied directory. metadata.json is preferred since it's already fully
+// evaluated, otherwise metadata.rb is parsed with chef.ParseMetadataRb. If the
+// metadata doesn't name the cookbook, the name of the directory is used, just
+// like Chef does.
+//
+// Usage:
+//
+//     metadata, err := chef.ReadCookbookMetadata("cookbooks/apache2")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println(metadata.Name, metadata.Version, metadata.Dependencies)
+func ReadCookbookMetadata(dir string) (*CookbookMetadata, error) {
+	var metadata *CookbookMetadata
+
+	jsonFile := filepath.Join(dir, "metadata.json")
+	rbFile := filepath.Join(dir, "metadata.rb")
+	content, err := ioutil.ReadFile(jsonFile)
+	switch {
+	case err == nil:
+		metadata, err = ParseMetadataJSON(content)
+		if err != nil {
+			return nil, &MetadataError{File: jsonFile, Message: err.Error()}
+		}
+	case os.IsNotExist(err):
+		content, err = ioutil.ReadFile(rbFile)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no metadata.json or metadata.rb found in %s", dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+		metadata, err = ParseMetadataRb(content, dir)
+		if err != nil {
+			if metadataErr, ok := err.(*MetadataError); ok {
+				metadataErr.File = rbFile
+			}
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if metadata.Name == "" {
+		metadata.Name = filepath.Base(filepath.Clean(dir))
+	}
+	return metadata, nil
+}
+
+// chef.ParseMetadataJSON parses the content of a metadata.json file into a
+// *chef.CookbookMetadata type
+func ParseMetadataJSON(content []byte) (*CookbookMetadata, error) {
+	metadata := newCookbookMetadata()
+	if err := json.Unmarshal(content, metadata); err != nil {
+		return nil, err
+	}
+	if _, err := ParseVersion(metadata.Version); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func newCookbookMetadata() *CookbookMetadata {
+	return &CookbookMetadata{
+		Version:      "0.0.0",
+		Platforms:    map[string]string{},
+		Dependencies: map[string]string{},
+		Providing:    map[string]string{},
+		Attributes:   map[string]interface{}{},
+		Recipes:      map[string]string{},
+	}
+}
+
+// metadataIgnored lists the metadata.rb methods which are understood but have
+// no counterpart in chef.CookbookMetadata, so they are skipped
+var metadataIgnored = map[string]bool{
+	"attribute":            true,
+	"chef_version":         true,
+	"conflicts":            true,
+	"eager_load_libraries": true,
+	"gem":                  true,
+	"grouping":             true,
+	"issues_url":           true,
+	"ohai_version":         true,
+	"privacy":              true,
+	"recommends":           true,
+	"replaces":             true,
+	"source_url":           true,
+	"suggests":             true,
+}
+
+// readmeRegexp matches the usual way of loading the long description from the
+// cookbook's README
+var readmeRegexp = regexp.MustCompile(`^(?:IO|File)\.read\(\s*File\.join\(\s*File\.dirname\(\s*__FILE__\s*\)\s*,\s*(?:'([^']+)'|"([^"#]+)")\s*\)\s*\)$`)
+
+// chef.ParseMetadataRb parses the content of a metadata.rb file into a
+// *chef.CookbookMetadata type without running Ruby. It understands the name,
+// version, description, long_description, maintainer, maintainer_email,
+// license, depends, supports, provides and recipe statements when their
+// arguments are plain string literals. A few other statements, such as
+// source_url or chef_version, are accepted and skipped. Anything else, such as
+// loops, variables or string interpolation, results in a *chef.MetadataError.
+//
+// The dir argument is the cookbook's directory. It is used to resolve the
+// common long_description IO.read(File.join(File.dirname(__FILE__), 'README.md'))
+// idiom and may be empty if that isn't needed.
+//
+// Usage:
+//
+//     content, _ := ioutil.ReadFile("cookbooks/apache2/metadata.rb")
+//     metadata, err := chef.ParseMetadataRb(content, "cookbooks/apache2")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println(metadata.Name, metadata.Version)
+func ParseMetadataRb(content []byte, dir string) (*CookbookMetadata, error) {
+	statements, err := lexRuby(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := newCookbookMetadata()
+	for _, statement := range statements {
+		if err := metadata.evalRb(statement, dir); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+func (m *CookbookMetadata) evalRb(s rbStatement, dir string) error {
+	fail := func(format string, args ...interface{}) error {
+		return &MetadataError{File: "metadata.rb", Line: s.line, Message: fmt.Sprintf(format, args...)}
+	}
+
+	method := s.tokens[0]
+	if method.kind != rbIdent {
+		return fail("cannot evaluate '%s'", s.text)
+	}
+	if metadataIgnored[method.text] {
+		return nil
+	}
+
+	args, ok := s.stringArgs()
+	if !ok {
+		if method.text == "long_description" {
+			if file := readmeRegexp.FindStringSubmatch(strings.TrimSpace(s.argText())); file != nil && dir != "" {
+				path := filepath.Join(dir, file[1]+file[2])
+				// the README must be part of the cookbook, it's uploaded
+				// along with its metadata
+				if rel, err := filepath.Rel(dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+					return fail("long_description file '%s' is outside the cookbook", file[1]+file[2])
+				}
+				readme, err := ioutil.ReadFile(path)
+				if err != nil {
+					return fail("%s", err)
+				}
+				m.LongDescription = string(readme)
+				return nil
+			}
+		}
+		return fail("cannot statically evaluate '%s', only string literal arguments are supported", s.text)
+	}
+
+	arity := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			return fail("wrong number of arguments for %s", method.text)
+		}
+		return nil
+	}
+	constraint := func(args []string) (string, error) {
+		if len(args) < 2 {
+			return ">= 0.0.0", nil
+		}
+		if _, err := ParseVersionConstraint(args[1]); err != nil {
+			return "", fail("%s", err)
+		}
+		return args[1], nil
+	}
+
+	switch method.text {
+	case "name", "version", "description", "long_description", "maintainer", "maintainer_email", "license":
+		if err := arity(1, 1); err != nil {
+			return err
+		}
+		switch method.text {
+		case "name":
+			m.Name = args[0]
+		case "version":
+			if _, err := ParseVersion(args[0]); err != nil {
+				return fail("%s", err)
+			}
+			m.Version = args[0]
+		case "description":
+			m.Description = args[0]
+		case "long_description":
+			m.LongDescription = args[0]
+		case "maintainer":
+			m.Maintainer = args[0]
+		case "maintainer_email":
+			m.MaintainerEmail = args[0]
+		case "license":
+			m.License = args[0]
+		}
+	case "depends", "supports", "provides":
+		if err := arity(1, 2); err != nil {
+			return err
+		}
+		c, err := constraint(args)
+		if err != nil {
+			return err
+		}
+		switch method.text {
+		case "depends":
+			m.Dependencies[args[0]] = c
+		case "supports":
+			m.Platforms[args[0]] = c
+		case "provides":
+			m.Providing[args[0]] = c
+		}
+	case "recipe":
+		if err := arity(2, 2); err != nil {
+			return err
+		}
+		m.Recipes[args[0]] = args[1]
+	default:
+		return fail("unsupported metadata statement '%s'", method.text)
+	}
+	return nil
+}
+
+// The following is a tiny lexer for the subset of Ruby found in metadata.rb
+// files: method calls with optional parentheses and comma separated string
+// literal arguments, spread over one or more lines.
+
+const (
+	rbIdent = iota
+	rbString
+	rbPunct
+	rbOther
+)
+
+type rbToken struct {
+	kind int
+	text string
+}
+
+type rbStatement struct {
+	tokens []rbToken
+	text   string
+	line   int
+}
+
+// stringArgs returns the arguments of the statement if they are all string
+// literals
+func (s rbStatement) stringArgs() ([]string, bool) {
+	tokens := s.tokens[1:]
+	if len(tokens) > 0 && tokens[0].text == "(" {
+		if tokens[len(tokens)-1].text != ")" {
+			return nil, false
+		}
+		tokens = tokens[1 : len(tokens)-1]
+	}
+	args := []string{}
+	for i, token := range tokens {
+		if i%2 == 1 {
+			if token.text != "," {
+				return nil, false
+			}
+			continue
+		}
+		if token.kind != rbString {
+			return nil, false
+		}
+		args = append(args, token.text)
+	}
+	if len(tokens) > 0 && len(tokens)%2 == 0 {
+		// trailing comma
+		return nil, false
+	}
+	return args, true
+}
+
+// argText returns the raw source of the statement's arguments
+func (s rbStatement) argText() string {
+	return strings.TrimPrefix(s.text, s.tokens[0].text)
+}
+
+func lexRuby(src string) ([]rbStatement, error) {
+	statements := []rbStatement{}
+	current := rbStatement{}
+	start := 0
+	depth := 0
+	line := 1
+
+	fail := func(format string, args ...interface{}) error {
+		return &MetadataError{File: "metadata.rb", Line: line, Message: fmt.Sprintf(format, args...)}
+	}
+	add := func(kind int, text string, from, to int) {
+		if len(current.tokens) == 0 {
+			current.line = line
+			start = from
+		}
+		current.tokens = append(current.tokens, rbToken{kind, text})
+		current.text = strings.TrimSpace(src[start:to])
+	}
+	end := func() {
+		if len(current.tokens) > 0 {
+			statements = append(statements, current)
+		}
+		current = rbStatement{}
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '\\' && i+1 < len(src) && src[i+1] == '\n':
+			i += 2
+			line++
+		case c == '\n':
+			last := len(current.tokens) - 1
+			if depth == 0 && (last < 0 || current.tokens[last].text != ",") {
+				end()
+			}
+			i++
+			line++
+		case c == ';' && depth == 0:
+			end()
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '\'' || c == '"':
+			from := i
+			startLine := line
+			var value strings.Builder
+			i++
+			for {
+				if i >= len(src) {
+					line = startLine
+					return nil, fail("unterminated string")
+				}
+				ch := src[i]
+				if ch == c {
+					i++
+					break
+				}
+				if ch == '\n' {
+					line++
+				}
+				if c == '"' && ch == '#' && i+1 < len(src) && src[i+1] == '{' {
+					return nil, fail("string interpolation can't be evaluated statically")
+				}
+				if ch == '\\' && i+1 < len(src) {
+					next := src[i+1]
+					switch {
+					case c == '\'' && (next == '\'' || next == '\\'):
+						value.WriteByte(next)
+					case c == '\'':
+						value.WriteByte(ch)
+						value.WriteByte(next)
+					case next == 'n':
+						value.WriteByte('\n')
+					case next == 't':
+						value.WriteByte('\t')
+					default:
+						value.WriteByte(next)
+					}
+					i += 2
+					continue
+				}
+				value.WriteByte(ch)
+				i++
+			}
+			add(rbString, value.String(), from, i)
+		case c == '(' || c == ')' || c == ',':
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+			}
+			add(rbPunct, string(c), i, i+1)
+			i++
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			from := i
+			for i < len(src) && isRbIdentChar(src[i]) {
+				i++
+			}
+			add(rbIdent, src[from:i], from, i)
+		default:
+			from := i
+			for i < len(src) && !strings.ContainsRune(" \t\r\n#'\"(),;", rune(src[i])) {
+				i++
+			}
+			if i == from {
+				i++
+			}
+			add(rbOther, src[from:i], from, i)
+		}
+	}
+	if depth != 0 {
+		return nil, fail("unbalanced parentheses")
+	}
+	end()
+	return statements, nil
+}
+
+func isRbIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c == '?' || c == '!' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,133 @@
+package chef
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMetadataRb = `
+name             'apache2' # the cookbook name
+maintainer       "Example, Inc."
+maintainer_email 'ops@example.com'
+license          'Apache 2.0'
+description      'Installs and configures apache2'
+long_description IO.read(File.join(File.dirname(__FILE__), 'README.md'))
+version          '1.10.2'
+source_url       'https://github.com/example/apache2' if respond_to?(:source_url)
+
+recipe 'apache2', "Main Apache configuration"
+recipe('apache2::mod_ssl', 'Apache module \'ssl\'')
+
+depends 'iptables',
+        '~> 1.0'
+depends 'logrotate'
+supports 'ubuntu', '>= 12.04'; supports 'centos'
+`
+
+func TestParseMetadataRb(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chef-metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# apache2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := ParseMetadataRb([]byte(testMetadataRb), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Name != "apache2" || metadata.Version != "1.10.2" || metadata.Maintainer != "Example, Inc." {
+		t.Errorf("unexpected metadata %#v", metadata)
+	}
+	if metadata.LongDescription != "# apache2\n" {
+		t.Error("long_description wasn't read from the README")
+	}
+	if metadata.Recipes["apache2::mod_ssl"] != "Apache module 'ssl'" {
+		t.Errorf("unexpected recipes %v", metadata.Recipes)
+	}
+	if metadata.Dependencies["iptables"] != "~> 1.0" || metadata.Dependencies["logrotate"] != ">= 0.0.0" {
+		t.Errorf("unexpected dependencies %v", metadata.Dependencies)
+	}
+	if metadata.Platforms["ubuntu"] != ">= 12.04" || metadata.Platforms["centos"] != ">= 0.0.0" {
+		t.Errorf("unexpected platforms %v", metadata.Platforms)
+	}
+}
+
+func TestParseMetadataRbReadmeOutsideCookbook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chef-metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cookbook := filepath.Join(dir, "apache2")
+	if err := os.Mkdir(cookbook, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("s3cr3t\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{"../secret", "docs/../../secret"} {
+		content := "name 'apache2'\nlong_description IO.read(File.join(File.dirname(__FILE__), '" + file + "'))"
+		metadata, err := ParseMetadataRb([]byte(content), cookbook)
+		if err == nil || !strings.HasPrefix(err.Error(), "metadata.rb:2:") {
+			t.Errorf("reading %s should have failed, got %v", file, err)
+		}
+		if metadata != nil && metadata.LongDescription != "" {
+			t.Errorf("%s was read", file)
+		}
+	}
+}
+
+func TestParseMetadataRbErrors(t *testing.T) {
+	known := map[string]string{
+		"name 'a'\nversion \"#{major}.0.0\"":                 "metadata.rb:2:",
+		"%w(ubuntu debian).each do |os|\n  supports os\nend": "metadata.rb:1:",
+		"name 'a'\n\ndepends 'b', node['version']":           "metadata.rb:3:",
+		"version '1.0'\nversion 'one'":                       "metadata.rb:2:",
+		"name 'a'\nlicense 'MIT',\n":                         "metadata.rb:2:",
+		"name 'unterminated":                                 "metadata.rb:1:",
+	}
+	for content, prefix := range known {
+		_, err := ParseMetadataRb([]byte(content), "")
+		if err == nil {
+			t.Errorf("parsing %q should have failed", content)
+			continue
+		}
+		if _, ok := err.(*MetadataError); !ok || !strings.HasPrefix(err.Error(), prefix) {
+			t.Errorf("parsing %q returned the wrong error: %s", content, err)
+		}
+	}
+}
+
+func TestReadCookbookMetadata(t *testing.T) {
+	metadata, err := ReadCookbookMetadata("test/support/chef/test_cook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Name != "test" {
+		t.Errorf("unexpected cookbook name %s", metadata.Name)
+	}
+
+	dir, err := ioutil.TempDir("", "chef-metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	json := `{"name": "apache2", "version": "1.10.2", "dependencies": {"iptables": ">= 0.0.0"}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "metadata.json"), []byte(json), 0644); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err = ReadCookbookMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Dependencies["iptables"] != ">= 0.0.0" {
+		t.Errorf("unexpected dependencies %v", metadata.Dependencies)
+	}
+}
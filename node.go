@@ -3,7 +3,7 @@ package chef
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
+	"net/http"
 )
 
 // chef.Node represents the relevant parameters of a Chef node
@@ -141,7 +141,7 @@ func (chef *Chef) GetNode(name string) (*Node, bool, error) {
 	}
 	body, err := responseBody(resp)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
+		if hasStatus(err, http.StatusNotFound) {
 			return nil, false, nil
 		}
 		return nil, false, err
@@ -1,47 +1,117 @@
 package chef
 
 import (
+	"crypto/rsa"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"net/http"
 )
 
-// chef.GetPrincipal returns a map of principal item names to their
-// corresponding RESTful url. It also returns a bool indicating whether or not
-// the client was found and an error indicating if the request failed or not.
-//
-// Note that if the request is successful but no such client existed, the error
-// return value will be nil but the bool will be false.
+// chef.Principal is a client or user the server knows how to authenticate,
+// along with the public key its requests are checked against. Type is either
+// "client" or "user".
+type Principal struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	PublicKey string `json:"public_key"`
+	AuthzID   string `json:"authz_id"`
+	OrgMember bool   `json:"org_member"`
+}
+
+// RSAPublicKey parses the principal's public key
+func (p *Principal) RSAPublicKey() (*rsa.PublicKey, error) {
+	key, err := parsePublicKey(p.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %s", p.Type, p.Name, err)
+	}
+	return key, nil
+}
+
+// chef.GetPrincipals returns every principal with the given name, as a client
+// and a user may share a name. It also returns a bool indicating whether or
+// not any principal was found and an error indicating if the request failed
+// or not.
 //
 // Usage:
 //
-//     principal, ok, err := chef.GetCookbookPrincipal("neo4j.example.org")
+//     principals, ok, err := chef.GetPrincipals("neo4j.example.org")
 //     if err != nil {
 //         fmt.Println(err)
 //         os.Exit(1)
 //     }
-//     if !ok {
-//         fmt.Println("Couldn't find that principal!")
-//     } else {
-//         // do what you please with the "principal" variable which is of the
-//         // map[string]string type
-//         fmt.Println(principal)
+//     for _, principal := range principals {
+//         fmt.Println(principal.Type, principal.Name)
 //     }
-func (chef *Chef) GetPrincipal(name string) (map[string]string, bool, error) {
+func (chef *Chef) GetPrincipals(name string) ([]Principal, bool, error) {
 	resp, err := chef.Get(fmt.Sprintf("principals/%s", name))
 	if err != nil {
 		return nil, false, err
 	}
 	body, err := responseBody(resp)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
+		if hasStatus(err, http.StatusNotFound) {
 			return nil, false, nil
 		}
 		return nil, false, err
 	}
 
-	principal := map[string]string{}
-	json.Unmarshal(body, &principal)
+	principals, err := parsePrincipals(body)
+	if err != nil {
+		return nil, false, err
+	}
+	return principals, len(principals) > 0, nil
+}
 
-	return principal, true, nil
+// chef.GetPrincipal returns the principal with the given name. It also returns
+// a bool indicating whether or not the principal was found and an error
+// indicating if the request failed or not. If a client and a user share the
+// name, the first one the server lists is returned, use chef.GetPrincipals to
+// get both.
+//
+// Note that if the request is successful but no such principal existed, the
+// error return value will be nil but the bool will be false.
+//
+// Usage:
+//
+//     principal, ok, err := chef.GetPrincipal("neo4j.example.org")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     if !ok {
+//         fmt.Println("Couldn't find that principal!")
+//     } else {
+//         // do what you please with the "principal" variable which is of the
+//         // *chef.Principal type
+//         fmt.Println(principal.Type, principal.PublicKey)
+//     }
+func (chef *Chef) GetPrincipal(name string) (*Principal, bool, error) {
+	principals, ok, err := chef.GetPrincipals(name)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	return &principals[0], true, nil
+}
+
+// parsePrincipals decodes either a single principal or, with newer API
+// versions, a {"principals": [...]} list of them
+func parsePrincipals(body []byte) ([]Principal, error) {
+	var list struct {
+		Principals []Principal `json:"principals"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	if list.Principals != nil {
+		return list.Principals, nil
+	}
+
+	principal := Principal{}
+	if err := json.Unmarshal(body, &principal); err != nil {
+		return nil, err
+	}
+	if principal.Name == "" {
+		return []Principal{}, nil
+	}
+	return []Principal{principal}, nil
 }
@@ -15,3 +15,25 @@ func TestGetPrincipal(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestParsePrincipals(t *testing.T) {
+	v0 := `{"name": "web1", "type": "client", "public_key": "PUBLIC", "authz_id": "abc", "org_member": true}`
+	v1 := `{"principals": [` + v0 + `, {"name": "web1", "type": "user", "public_key": "OTHER", "authz_id": "def", "org_member": false}]}`
+
+	principals, err := parsePrincipals([]byte(v0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Principal{"web1", "client", "PUBLIC", "abc", true}
+	if len(principals) != 1 || principals[0] != expected {
+		t.Errorf("unexpected principals %v", principals)
+	}
+
+	principals, err = parsePrincipals([]byte(v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(principals) != 2 || principals[0] != expected || principals[1].Type != "user" {
+		t.Errorf("unexpected principals %v", principals)
+	}
+}
@@ -0,0 +1,257 @@
+package chef
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// chef.EnvironmentDiff describes how a target environment differs from a
+// source environment, as the changes that would make the target match the
+// source: cookbook version pin changes and attribute changes.
+type EnvironmentDiff struct {
+	Source     string
+	Target     string
+	Pins       []PinChange
+	Attributes []AttributeChange
+}
+
+// chef.PinChange is a cookbook version pin which differs between two
+// environments. Change is "upgrade" or "downgrade" when the source pins a
+// newer or older version than the target, "changed" when only the operator
+// differs, "added" when only the source pins the cookbook and "removed" when
+// only the target does.
+type PinChange struct {
+	Cookbook string
+	Change   string
+	Source   string
+	Target   string
+}
+
+// chef.AttributeChange is an attribute which differs between two
+// environments. Precedence is "default" or "override" and Path is the list of
+// keys leading to the attribute. Change is "added" when only the source sets
+// it, "removed" when only the target does and "modified" otherwise.
+type AttributeChange struct {
+	Precedence string
+	Path       []string
+	Change     string
+	Source     interface{}
+	Target     interface{}
+}
+
+// Empty returns true if the environments have the same pins and attributes
+func (d *EnvironmentDiff) Empty() bool {
+	return len(d.Pins) == 0 && len(d.Attributes) == 0
+}
+
+// String returns the attribute's path in the "default.apache.listen_ports"
+// form
+func (c AttributeChange) String() string {
+	return strings.Join(append([]string{c.Precedence}, c.Path...), ".")
+}
+
+// chef.CompareEnvironments compares two environments and returns what would
+// have to change in the target environment for it to match the source, e.g.
+// when promoting staging to production.
+//
+// Usage:
+//
+//     staging, _, _ := chef.GetEnvironment("staging")
+//     production, _, _ := chef.GetEnvironment("production")
+//     diff := chef.CompareEnvironments(staging, production)
+//     for _, pin := range diff.Pins {
+//         fmt.Println(pin.Cookbook, pin.Change, pin.Target, "->", pin.Source)
+//     }
+//     for _, attribute := range diff.Attributes {
+//         fmt.Println(attribute, attribute.Change)
+//     }
+func CompareEnvironments(source, target *Environment) *EnvironmentDiff {
+	diff := &EnvironmentDiff{Source: source.Name, Target: target.Name}
+
+	for _, name := range sortedKeys(source.CookbookVersions, target.CookbookVersions) {
+		s, inSource := source.CookbookVersions[name]
+		t, inTarget := target.CookbookVersions[name]
+		if inSource && inTarget && s == t {
+			continue
+		}
+		change := PinChange{Cookbook: name, Source: s, Target: t}
+		switch {
+		case !inTarget:
+			change.Change = "added"
+		case !inSource:
+			change.Change = "removed"
+		default:
+			change.Change = "changed"
+			sourceConstraint, err1 := ParseVersionConstraint(s)
+			targetConstraint, err2 := ParseVersionConstraint(t)
+			if err1 == nil && err2 == nil {
+				switch sourceConstraint.Version.Compare(targetConstraint.Version) {
+				case 1:
+					change.Change = "upgrade"
+				case -1:
+					change.Change = "downgrade"
+				}
+			}
+		}
+		diff.Pins = append(diff.Pins, change)
+	}
+
+	diff.Attributes = append(diff.Attributes, compareAttributes("default", nil, source.DefaultAttributes, target.DefaultAttributes)...)
+	diff.Attributes = append(diff.Attributes, compareAttributes("override", nil, source.OverrideAttributes, target.OverrideAttributes)...)
+
+	return diff
+}
+
+// compareAttributes walks two attribute trees and reports the leaves which
+// differ. Arrays are compared as a whole, just like Chef merges them.
+func compareAttributes(precedence string, path []string, source, target map[string]interface{}) []AttributeChange {
+	keys := map[string]string{}
+	for key := range source {
+		keys[key] = key
+	}
+	for key := range target {
+		keys[key] = key
+	}
+
+	changes := []AttributeChange{}
+	for _, key := range sortedKeys(keys) {
+		s, inSource := source[key]
+		t, inTarget := target[key]
+		keyPath := append(append([]string{}, path...), key)
+
+		sourceMap, sourceIsMap := s.(map[string]interface{})
+		targetMap, targetIsMap := t.(map[string]interface{})
+		if sourceIsMap && targetIsMap {
+			changes = append(changes, compareAttributes(precedence, keyPath, sourceMap, targetMap)...)
+			continue
+		}
+
+		change := AttributeChange{Precedence: precedence, Path: keyPath, Source: s, Target: t}
+		switch {
+		case !inTarget:
+			change.Change = "added"
+		case !inSource:
+			change.Change = "removed"
+		case reflect.DeepEqual(s, t):
+			continue
+		default:
+			change.Change = "modified"
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// chef.ApplyEnvironmentDiff applies the pin and attribute changes of a diff,
+// which may have been filtered down to a subset of what chef.CompareEnvironments
+// returned, to an environment
+func ApplyEnvironmentDiff(env *Environment, diff *EnvironmentDiff) {
+	if env.CookbookVersions == nil {
+		env.CookbookVersions = map[string]string{}
+	}
+	for _, pin := range diff.Pins {
+		if pin.Change == "removed" {
+			delete(env.CookbookVersions, pin.Cookbook)
+		} else {
+			env.CookbookVersions[pin.Cookbook] = pin.Source
+		}
+	}
+
+	for _, attribute := range diff.Attributes {
+		attributes := &env.DefaultAttributes
+		if attribute.Precedence == "override" {
+			attributes = &env.OverrideAttributes
+		}
+		if *attributes == nil {
+			*attributes = map[string]interface{}{}
+		}
+		if attribute.Change == "removed" {
+			deleteAttribute(*attributes, attribute.Path)
+		} else {
+			setAttribute(*attributes, attribute.Path, attribute.Source)
+		}
+	}
+}
+
+// setAttribute sets the value at the given path, creating intermediate maps as
+// needed
+func setAttribute(attributes map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := attributes[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			attributes[key] = next
+		}
+		attributes = next
+	}
+	attributes[path[len(path)-1]] = value
+}
+
+// deleteAttribute removes the value at the given path, if there is one
+func deleteAttribute(attributes map[string]interface{}, path []string) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := attributes[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		attributes = next
+	}
+	delete(attributes, path[len(path)-1])
+}
+
+// chef.PromoteEnvironment applies the changes of a diff returned by
+// chef.CompareEnvironments, usually filtered down to the pins and attributes
+// you want to promote, to the diff's target environment. The target is read
+// fresh from the server and modified with chef.UpdateEnvironment, so changes
+// made since the comparison aren't lost. The resulting environment is returned
+// along with its JSON representation. In dry run mode nothing is written and
+// the JSON shows what the environment would look like.
+//
+// Usage:
+//
+//     diff := chef.CompareEnvironments(staging, production)
+//     // only promote the cookbook pins
+//     diff.Attributes = nil
+//     _, preview, err := chef.PromoteEnvironment(diff, true)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println(string(preview))
+func (chef *Chef) PromoteEnvironment(diff *EnvironmentDiff, dryRun bool) (*Environment, []byte, error) {
+	if diff.Target == "_default" {
+		return nil, nil, ErrDefaultEnvironment
+	}
+
+	var env *Environment
+	var err error
+	if dryRun {
+		var ok bool
+		env, ok, err = chef.GetEnvironment(diff.Target)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			return nil, nil, fmt.Errorf("environment %s not found", diff.Target)
+		}
+		ApplyEnvironmentDiff(env, diff)
+	} else {
+		env, err = chef.UpdateEnvironment(diff.Target, func(env *Environment) error {
+			ApplyEnvironmentDiff(env, diff)
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	env.JSONClass = "Chef::Environment"
+	env.ChefType = "environment"
+	preview, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return env, preview, nil
+}
@@ -0,0 +1,97 @@
+package chef
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testEnvironments() (*Environment, *Environment) {
+	staging := &Environment{
+		Name: "staging",
+		CookbookVersions: map[string]string{
+			"apache2":   "= 1.10.2",
+			"mysql":     "= 5.0.0",
+			"logrotate": "~> 1.0",
+			"newrelic":  "= 2.0.0",
+		},
+		DefaultAttributes: map[string]interface{}{
+			"apache": map[string]interface{}{
+				"listen_ports": []interface{}{"80", "443"},
+				"timeout":      float64(300),
+			},
+		},
+		OverrideAttributes: map[string]interface{}{},
+	}
+	production := &Environment{
+		Name: "production",
+		CookbookVersions: map[string]string{
+			"apache2":   "= 1.9.0",
+			"mysql":     "= 5.1.0",
+			"logrotate": ">= 1.0",
+			"iptables":  "= 1.0.0",
+		},
+		DefaultAttributes: map[string]interface{}{
+			"apache": map[string]interface{}{
+				"listen_ports": []interface{}{"80"},
+				"timeout":      float64(300),
+				"keepalive":    "On",
+			},
+		},
+		OverrideAttributes: map[string]interface{}{
+			"mysql": map[string]interface{}{"tunable": "x"},
+		},
+	}
+	return staging, production
+}
+
+func TestCompareEnvironments(t *testing.T) {
+	staging, production := testEnvironments()
+	diff := CompareEnvironments(staging, production)
+
+	expected := []PinChange{
+		{"apache2", "upgrade", "= 1.10.2", "= 1.9.0"},
+		{"iptables", "removed", "", "= 1.0.0"},
+		{"logrotate", "changed", "~> 1.0", ">= 1.0"},
+		{"mysql", "downgrade", "= 5.0.0", "= 5.1.0"},
+		{"newrelic", "added", "= 2.0.0", ""},
+	}
+	if !reflect.DeepEqual(diff.Pins, expected) {
+		t.Errorf("unexpected pin changes %v", diff.Pins)
+	}
+
+	attributes := map[string]string{}
+	for _, change := range diff.Attributes {
+		attributes[change.String()] = change.Change
+	}
+	expectedAttributes := map[string]string{
+		"default.apache.keepalive":    "removed",
+		"default.apache.listen_ports": "modified",
+		"override.mysql":              "removed",
+	}
+	if !reflect.DeepEqual(attributes, expectedAttributes) {
+		t.Errorf("unexpected attribute changes %v", attributes)
+	}
+}
+
+func TestApplyEnvironmentDiff(t *testing.T) {
+	staging, production := testEnvironments()
+	diff := CompareEnvironments(staging, production)
+
+	// only promote the upgrades and the listen ports
+	diff.Pins = diff.Pins[:1]
+	diff.Attributes = diff.Attributes[1:2]
+	ApplyEnvironmentDiff(production, diff)
+
+	if production.CookbookVersions["apache2"] != "= 1.10.2" || production.CookbookVersions["mysql"] != "= 5.1.0" {
+		t.Errorf("unexpected pins %v", production.CookbookVersions)
+	}
+	apache := production.DefaultAttributes["apache"].(map[string]interface{})
+	if !reflect.DeepEqual(apache["listen_ports"], []interface{}{"80", "443"}) || apache["keepalive"] != "On" {
+		t.Errorf("unexpected attributes %v", apache)
+	}
+
+	ApplyEnvironmentDiff(production, CompareEnvironments(staging, production))
+	if !CompareEnvironments(staging, production).Empty() {
+		t.Error("applying the whole diff should make both environments match")
+	}
+}
@@ -0,0 +1,212 @@
+package chef
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// chef.PruneOptions controls which cookbook versions chef.PruneCookbook and
+// chef.PruneCookbooks delete
+type PruneOptions struct {
+	// Keep is the number of newest versions of each cookbook to keep
+	Keep int
+	// Purge also removes the files of the deleted versions from the server
+	Purge bool
+	// DryRun reports what would be deleted without deleting anything
+	DryRun bool
+}
+
+// chef.PruneResult reports what happened to the versions of a pruned cookbook.
+// Kept maps each version which was kept to the reason it was kept.
+type PruneResult struct {
+	Cookbook string
+	Deleted  []string
+	Kept     map[string]string
+}
+
+// chef.PruneCookbook deletes every version of a cookbook except the newest
+// options.Keep versions, the versions that environments pin and the versions
+// that nodes reported using in their last chef run.
+//
+// Usage:
+//
+//     result, err := chef.PruneCookbook("apache2", chef.PruneOptions{Keep: 5})
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, version := range result.Deleted {
+//         fmt.Println("deleted", version)
+//     }
+//     for version, reason := range result.Kept {
+//         fmt.Println("kept", version, reason)
+//     }
+func (chef *Chef) PruneCookbook(name string, options PruneOptions) (*PruneResult, error) {
+	cookbook, ok, err := chef.GetCookbook(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || cookbook == nil {
+		return nil, fmt.Errorf("cookbook %s not found", name)
+	}
+	results, err := chef.pruneCookbooks(map[string]*Cookbook{name: cookbook}, options)
+	return results[name], err
+}
+
+// chef.PruneCookbooks prunes every cookbook on the server the same way
+// chef.PruneCookbook does, returning a map of cookbook names to the result of
+// pruning that cookbook. Environments and nodes are only looked up once.
+func (chef *Chef) PruneCookbooks(options PruneOptions) (map[string]*PruneResult, error) {
+	cookbooks, err := chef.GetCookbooksWithVersions(AllVersions)
+	if err != nil {
+		return nil, err
+	}
+	return chef.pruneCookbooks(cookbooks, options)
+}
+
+func (chef *Chef) pruneCookbooks(cookbooks map[string]*Cookbook, options PruneOptions) (map[string]*PruneResult, error) {
+	if options.Keep < 0 {
+		return nil, fmt.Errorf("invalid number of versions to keep: %d", options.Keep)
+	}
+
+	available := map[string][]string{}
+	for name, cookbook := range cookbooks {
+		for _, version := range cookbook.Versions {
+			available[name] = append(available[name], version.Version)
+		}
+	}
+	usage, err := chef.cookbookUsage(available)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range available {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := map[string]*PruneResult{}
+	for _, name := range names {
+		prunable, kept := prunableVersions(available[name], options.Keep, usage[name])
+		result := &PruneResult{Cookbook: name, Kept: kept}
+		results[name] = result
+		for _, version := range prunable {
+			if !options.DryRun {
+				if options.Purge {
+					err = chef.PurgeCookbookVersion(name, version)
+				} else {
+					err = chef.DeleteCookbookVersion(name, version)
+				}
+				if err != nil {
+					return results, fmt.Errorf("deleting %s %s: %s", name, version, err)
+				}
+			}
+			result.Deleted = append(result.Deleted, version)
+		}
+	}
+	return results, nil
+}
+
+// prunableVersions splits the versions of a cookbook into the ones which can
+// be deleted and the ones which must be kept, along with the reason why
+func prunableVersions(versions []string, keep int, inUse map[string]string) ([]string, map[string]string) {
+	kept := map[string]string{}
+	parsed := map[string]string{}
+	normalized := []string{}
+	for _, version := range versions {
+		v, err := ParseVersion(version)
+		if err != nil {
+			kept[version] = "unparseable version"
+			continue
+		}
+		parsed[v.String()] = version
+		normalized = append(normalized, v.String())
+	}
+
+	prunable := []string{}
+	for i, v := range sortVersionsDescending(normalized) {
+		version := parsed[v.String()]
+		switch {
+		case i < keep:
+			kept[version] = fmt.Sprintf("one of the %d newest versions", keep)
+		case inUse[v.String()] != "":
+			kept[version] = inUse[v.String()]
+		default:
+			prunable = append(prunable, version)
+		}
+	}
+	return prunable, kept
+}
+
+// cookbookUsage returns a map of cookbook names to a map of normalized
+// versions to the reason that version is in use: either an environment pins it
+// or a node reported running it
+func (chef *Chef) cookbookUsage(available map[string][]string) (map[string]map[string]string, error) {
+	usage := map[string]map[string]string{}
+	use := func(name, version, reason string) {
+		if usage[name] == nil {
+			usage[name] = map[string]string{}
+		}
+		if usage[name][version] == "" {
+			usage[name][version] = reason
+		}
+	}
+
+	environments, err := chef.GetEnvironments()
+	if err != nil {
+		return nil, err
+	}
+	for envName := range environments {
+		env, ok, err := chef.GetEnvironment(envName)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		for name, pin := range env.CookbookVersions {
+			constraint, err := ParseVersionConstraint(pin)
+			if err != nil {
+				return nil, fmt.Errorf("environment %s pin for %s: %s", envName, name, err)
+			}
+			// the environment serves the newest version matching its pin
+			for _, version := range sortVersionsDescending(available[name]) {
+				if constraint.Satisfies(version) {
+					use(name, version.String(), fmt.Sprintf("pinned by environment %s", envName))
+					break
+				}
+			}
+		}
+	}
+
+	err = chef.searchAll("node", "*:*", func(row json.RawMessage) error {
+		// only decode what we need, full node objects are big and their
+		// automatic attributes vary wildly between platforms
+		var node struct {
+			Name      string `json:"name"`
+			Automatic struct {
+				Cookbooks map[string]struct {
+					Version string `json:"version"`
+				} `json:"cookbooks"`
+			} `json:"automatic"`
+		}
+		if err := json.Unmarshal(row, &node); err != nil {
+			return err
+		}
+		for name, cookbook := range node.Automatic.Cookbooks {
+			version, err := ParseVersion(cookbook.Version)
+			if err != nil {
+				continue
+			}
+			use(name, version.String(), fmt.Sprintf("used by node %s", node.Name))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
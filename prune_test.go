@@ -0,0 +1,36 @@
+package chef
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrunableVersions(t *testing.T) {
+	versions := []string{"1.0.0", "1.2", "1.10.0", "2.0.0", "0.9.1", "banana"}
+	inUse := map[string]string{"1.0.0": "pinned by environment production"}
+
+	prunable, kept := prunableVersions(versions, 2, inUse)
+	if !reflect.DeepEqual(prunable, []string{"1.2", "0.9.1"}) {
+		t.Errorf("unexpected prunable versions %v", prunable)
+	}
+	for _, version := range []string{"2.0.0", "1.10.0", "1.0.0", "banana"} {
+		if kept[version] == "" {
+			t.Errorf("version %s should have been kept", version)
+		}
+	}
+	if kept["1.0.0"] != inUse["1.0.0"] {
+		t.Errorf("wrong reason for keeping 1.0.0: %s", kept["1.0.0"])
+	}
+}
+
+func TestPruneCookbookDryRun(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	result, err := chef.PruneCookbook(config.RequiredCookbook.Name, PruneOptions{Keep: 1, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Kept) == 0 {
+		t.Error("Dry run should keep at least one version")
+	}
+}
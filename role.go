@@ -1,19 +1,35 @@
 package chef
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"regexp"
 	"strings"
 )
 
 // chef.Role represents the relevant attributes of a Chef role
 type Role struct {
 	Name               string                 `json:"name"`
+	Description        string                 `json:"description"`
 	ChefType           string                 `json:"chef_type"`
 	JSONClass          string                 `json:"json_class"`
 	DefaultAttributes  map[string]interface{} `json:"default_attributes"`
 	OverrideAttributes map[string]interface{} `json:"override_attributes"`
 	RunList            []string               `json:"run_list"`
+	EnvRunLists        map[string][]string    `json:"env_run_lists"`
+}
+
+// RunListFor returns the run list the role applies to nodes of the supplied
+// environment: the environment specific run list if the role has one, even if
+// it's empty, and the role's default run list otherwise
+func (role *Role) RunListFor(environment string) []string {
+	if runList, ok := role.EnvRunLists[environment]; ok && environment != "_default" {
+		return runList
+	}
+	return role.RunList
 }
 
 // chef.GetRoles returns a map of role names to a string which represents the
@@ -76,7 +92,7 @@ func (chef *Chef) GetRole(name string) (*Role, bool, error) {
 	}
 	body, err := responseBody(resp)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
+		if hasStatus(err, http.StatusNotFound) {
 			return nil, false, nil
 		}
 		return nil, false, err
@@ -87,3 +103,286 @@ func (chef *Chef) GetRole(name string) (*Role, bool, error) {
 
 	return role, true, nil
 }
+
+// roleNameRegexp matches the role names the Chef server accepts
+var roleNameRegexp = regexp.MustCompile(`^[\-[:alnum:]_]+$`)
+
+// the run list item forms chef-client accepts: recipe[name@version],
+// role[name] and the unqualified name@version
+var (
+	qualifiedRecipeRegexp = regexp.MustCompile(`^recipe\[([^\]@]+)(@[0-9]+(\.[0-9]+){1,2})?\]$`)
+	qualifiedRoleRegexp   = regexp.MustCompile(`^role\[([^\]]+)\]$`)
+	unqualifiedRegexp     = regexp.MustCompile(`^[^@\[\]]+(@[0-9]+(\.[0-9]+){1,2})?$`)
+)
+
+// chef.ValidateRunList checks that every item of a run list is a valid
+// "recipe[...]" or "role[...]" item, or an unqualified recipe name such as
+// "apache2::mod_ssl", optionally with a version for recipes.
+func ValidateRunList(runList []string) error {
+	for _, item := range runList {
+		if !qualifiedRecipeRegexp.MatchString(item) &&
+			!qualifiedRoleRegexp.MatchString(item) &&
+			!unqualifiedRegexp.MatchString(item) {
+			return fmt.Errorf("invalid run list item '%s'", item)
+		}
+	}
+	return nil
+}
+
+// chef.ValidateRole checks the role's name and the syntax of its default and
+// environment specific run lists, the way the Chef server would
+func ValidateRole(role *Role) error {
+	if !roleNameRegexp.MatchString(role.Name) {
+		return fmt.Errorf("invalid role name '%s'", role.Name)
+	}
+	if err := ValidateRunList(role.RunList); err != nil {
+		return fmt.Errorf("role %s: %s", role.Name, err)
+	}
+	for env, runList := range role.EnvRunLists {
+		if err := ValidateRunList(runList); err != nil {
+			return fmt.Errorf("role %s, environment %s: %s", role.Name, env, err)
+		}
+	}
+	return nil
+}
+
+// chef.CreateRole creates a new role on the server from the supplied
+// *chef.Role type, after checking it with chef.ValidateRole. The json_class
+// and chef_type fields are set for you.
+//
+// Usage:
+//
+//     role := &chef.Role{
+//         Name:    "webserver",
+//         RunList: []string{"role[base]", "recipe[apache2]"},
+//     }
+//     err := chef.CreateRole(role)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) CreateRole(role *Role) error {
+	payload, err := rolePayload(role)
+	if err != nil {
+		return err
+	}
+	resp, err := chef.Post("roles", "application/json", nil, payload)
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// chef.UpdateRole reads the role with the given name, hands it to the supplied
+// function to be modified, checks the result with chef.ValidateRole and writes
+// it back to the server. The updated role is returned. If the function returns
+// an error, nothing is written. To replace a role entirely, e.g. with one kept
+// in version control, assign it in the function.
+//
+// Usage:
+//
+//     role, err := chef.UpdateRole("webserver", func(role *chef.Role) error {
+//         role.RunList = append(role.RunList, "recipe[logrotate]")
+//         return nil
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) UpdateRole(name string, update func(*Role) error) (*Role, error) {
+	role, ok, err := chef.GetRole(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("role %s not found", name)
+	}
+	if role.DefaultAttributes == nil {
+		role.DefaultAttributes = map[string]interface{}{}
+	}
+	if role.OverrideAttributes == nil {
+		role.OverrideAttributes = map[string]interface{}{}
+	}
+	if role.EnvRunLists == nil {
+		role.EnvRunLists = map[string][]string{}
+	}
+
+	if err := update(role); err != nil {
+		return nil, err
+	}
+
+	payload, err := rolePayload(role)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chef.Put(fmt.Sprintf("roles/%s", name), nil, payload)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := responseBody(resp); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// chef.DeleteRole deletes the role with the given name from the server.
+//
+// Usage:
+//
+//     err := chef.DeleteRole("webserver")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) DeleteRole(name string) error {
+	resp, err := chef.Delete(fmt.Sprintf("roles/%s", name), nil)
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// rolePayload validates a role and returns its JSON representation the way
+// the server expects it
+func rolePayload(role *Role) (io.Reader, error) {
+	if err := ValidateRole(role); err != nil {
+		return nil, err
+	}
+	payload := *role
+	payload.JSONClass = "Chef::Role"
+	payload.ChefType = "role"
+	if payload.RunList == nil {
+		payload.RunList = []string{}
+	}
+	if payload.EnvRunLists == nil {
+		payload.EnvRunLists = map[string][]string{}
+	}
+	if payload.DefaultAttributes == nil {
+		payload.DefaultAttributes = map[string]interface{}{}
+	}
+	if payload.OverrideAttributes == nil {
+		payload.OverrideAttributes = map[string]interface{}{}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(body), nil
+}
+
+// chef.ExpandRunList expands the roles of a run list, recursively, into the
+// list of recipes a node with that run list would run, the same way
+// chef-client does: roles are expanded in place, recipes which are already in
+// the list are skipped and a role included twice is only expanded once. The
+// recipes are returned without the "recipe[...]" wrapper, e.g.
+// "apache2::mod_ssl". Roles are expanded with their default run lists, use
+// chef.ExpandEnvironmentRunList for nodes outside of the _default environment.
+//
+// Usage:
+//
+//     recipes, err := chef.ExpandRunList([]string{"role[webserver]", "recipe[ntp]"})
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, recipe := range recipes {
+//         fmt.Println(recipe)
+//     }
+func (chef *Chef) ExpandRunList(runList []string) ([]string, error) {
+	return chef.ExpandEnvironmentRunList("_default", runList)
+}
+
+// chef.ExpandEnvironmentRunList works like chef.ExpandRunList but expands each
+// role with its run list for the supplied environment, see Role.RunListFor.
+//
+// Usage:
+//
+//     node, _, _ := chef.GetNode("web1.example.com")
+//     recipes, err := chef.ExpandEnvironmentRunList(node.Environment, node.RunList)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println(recipes)
+func (chef *Chef) ExpandEnvironmentRunList(environment string, runList []string) ([]string, error) {
+	return newRunListExpander(chef.GetRole, environment).expand(runList)
+}
+
+// runListRole returns the name of the role a run list item refers to, if it
+// refers to a role
+func runListRole(item string) (string, bool) {
+	item = strings.TrimSpace(item)
+	if strings.HasPrefix(item, "role[") && strings.HasSuffix(item, "]") {
+		return item[len("role[") : len(item)-1], true
+	}
+	return "", false
+}
+
+// runListExpander expands run lists for an environment, caching the roles it
+// fetches so that it can be reused for many run lists
+type runListExpander struct {
+	getRole     func(string) (*Role, bool, error)
+	environment string
+	roles       map[string]*Role
+}
+
+func newRunListExpander(getRole func(string) (*Role, bool, error), environment string) *runListExpander {
+	return &runListExpander{getRole: getRole, environment: environment, roles: map[string]*Role{}}
+}
+
+func (e *runListExpander) expand(runList []string) ([]string, error) {
+	recipes := []string{}
+	seenRecipes := map[string]bool{}
+	seenRoles := map[string]bool{}
+	if err := e.expandInto(runList, &recipes, seenRecipes, seenRoles); err != nil {
+		return nil, err
+	}
+	return recipes, nil
+}
+
+func (e *runListExpander) expandInto(runList []string, recipes *[]string, seenRecipes, seenRoles map[string]bool) error {
+	for _, item := range runList {
+		item = strings.TrimSpace(item)
+		if name, ok := runListRole(item); ok {
+			if seenRoles[name] {
+				continue
+			}
+			seenRoles[name] = true
+			role, err := e.role(name)
+			if err != nil {
+				return err
+			}
+			if err := e.expandInto(role.RunListFor(e.environment), recipes, seenRecipes, seenRoles); err != nil {
+				return err
+			}
+			continue
+		}
+
+		recipe := item
+		if strings.HasPrefix(recipe, "recipe[") && strings.HasSuffix(recipe, "]") {
+			recipe = recipe[len("recipe[") : len(recipe)-1]
+		}
+		if !seenRecipes[recipe] {
+			seenRecipes[recipe] = true
+			*recipes = append(*recipes, recipe)
+		}
+	}
+	return nil
+}
+
+func (e *runListExpander) role(name string) (*Role, error) {
+	if role, ok := e.roles[name]; ok {
+		return role, nil
+	}
+	role, ok, err := e.getRole(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("role %s not found", name)
+	}
+	e.roles[name] = role
+	return role, nil
+}
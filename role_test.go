@@ -1,6 +1,7 @@
 package chef
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -27,3 +28,128 @@ func TestGetRole(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestRunListExpander(t *testing.T) {
+	roles := map[string]*Role{
+		"base":      {Name: "base", RunList: []string{"recipe[ntp]", "recipe[users]"}},
+		"webserver": {Name: "webserver", RunList: []string{"role[base]", "recipe[apache2]", "role[webserver]"}},
+		"monitored": {
+			Name:        "monitored",
+			RunList:     []string{"recipe[nagios]"},
+			EnvRunLists: map[string][]string{"production": {"recipe[nagios]", "recipe[pagerduty]"}},
+		},
+	}
+	getRole := func(name string) (*Role, bool, error) {
+		role, ok := roles[name]
+		return role, ok, nil
+	}
+	expander := newRunListExpander(getRole, "_default")
+
+	recipes, err := expander.expand([]string{"recipe[ntp]", "role[webserver]", "apache2::mod_ssl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"ntp", "users", "apache2", "apache2::mod_ssl"}
+	if !reflect.DeepEqual(recipes, expected) {
+		t.Errorf("unexpected expansion %v", recipes)
+	}
+
+	if _, err := expander.expand([]string{"role[missing]"}); err == nil {
+		t.Error("missing roles should be reported")
+	}
+
+	recipes, err = newRunListExpander(getRole, "production").expand([]string{"role[monitored]", "role[base]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"nagios", "pagerduty", "ntp", "users"}
+	if !reflect.DeepEqual(recipes, expected) {
+		t.Errorf("unexpected expansion in production %v", recipes)
+	}
+}
+
+func TestRoleRunListFor(t *testing.T) {
+	role := &Role{
+		RunList: []string{"recipe[base]"},
+		EnvRunLists: map[string][]string{
+			"_default":   {"recipe[ignored]"},
+			"production": {"recipe[base]", "recipe[hardening]"},
+			"sandbox":    {},
+		},
+	}
+	tests := map[string][]string{
+		"_default":   {"recipe[base]"},
+		"staging":    {"recipe[base]"},
+		"production": {"recipe[base]", "recipe[hardening]"},
+		"sandbox":    {},
+	}
+	for environment, expected := range tests {
+		if runList := role.RunListFor(environment); !reflect.DeepEqual(runList, expected) {
+			t.Errorf("unexpected run list for %s: %v", environment, runList)
+		}
+	}
+}
+
+func TestValidateRole(t *testing.T) {
+	valid := &Role{
+		Name:        "web-server_2",
+		RunList:     []string{"role[base]", "recipe[apache2::mod_ssl@1.2.3]", "ntp", "users@1.0"},
+		EnvRunLists: map[string][]string{"production": {"recipe[hardening]"}},
+	}
+	if err := ValidateRole(valid); err != nil {
+		t.Error(err)
+	}
+
+	invalid := []*Role{
+		{Name: ""},
+		{Name: "web server"},
+		{Name: "web.server"},
+		{Name: "web", RunList: []string{"recipe[apache2"}},
+		{Name: "web", RunList: []string{"recipe[apache2@latest]"}},
+		{Name: "web", RunList: []string{"roles[base]"}},
+		{Name: "web", EnvRunLists: map[string][]string{"production": {"role[]"}}},
+	}
+	for _, role := range invalid {
+		if err := ValidateRole(role); err == nil {
+			t.Errorf("%v should be invalid", role)
+		}
+	}
+}
+
+func TestRoleCRUD(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	name := "chef_golang_test"
+
+	err := chef.CreateRole(&Role{Name: name, Description: "created by the tests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chef.DeleteRole(name)
+
+	_, err = chef.UpdateRole(name, func(role *Role) error {
+		role.RunList = []string{"recipe[chef_golang]"}
+		role.EnvRunLists["production"] = []string{}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	role, ok, err := chef.GetRole(name)
+	if err != nil || !ok {
+		t.Fatal("Couldn't find updated role", err)
+	}
+	if !reflect.DeepEqual(role.RunList, []string{"recipe[chef_golang]"}) {
+		t.Error("Run list wasn't updated")
+	}
+	if role.Description != "created by the tests" {
+		t.Error("Update lost the role's description")
+	}
+
+	if err := chef.DeleteRole(name); err != nil {
+		t.Error(err)
+	}
+	if _, ok, _ := chef.GetRole(name); ok {
+		t.Error("Role wasn't deleted")
+	}
+}
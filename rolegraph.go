@@ -0,0 +1,387 @@
+package chef
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// chef.RoleGraph describes how roles include each other and which roles nodes
+// reference. Includes maps every role to the roles it includes directly,
+// through its default run list or any of its environment specific run lists.
+// Nodes maps node names to the roles in their run lists. Missing lists the
+// roles which are referenced but don't exist.
+type RoleGraph struct {
+	Includes map[string][]string
+	Nodes    map[string][]string
+	Missing  []string
+}
+
+// chef.RoleDependent is a role or a node which uses a role. Path is the chain
+// of run list references from the dependent to the role, both included, so a
+// path of length two means the dependent references the role directly.
+type RoleDependent struct {
+	Name string
+	Path []string
+}
+
+// chef.RoleDependents lists the roles and nodes which use a role, directly or
+// through other roles
+type RoleDependents struct {
+	Roles []RoleDependent
+	Nodes []RoleDependent
+}
+
+// Direct returns true if the dependent references the role in its own run list
+func (d RoleDependent) Direct() bool {
+	return len(d.Path) == 2
+}
+
+// runListRoles returns the sorted, unique roles referenced by run lists
+func runListRoles(runLists ...[]string) []string {
+	names := map[string]string{}
+	for _, runList := range runLists {
+		for _, item := range runList {
+			if name, ok := runListRole(item); ok {
+				names[name] = name
+			}
+		}
+	}
+	return sortedKeys(names)
+}
+
+// chef.NewRoleGraph builds the graph of the supplied roles, keyed by name,
+// and of the nodes' run lists, given as a map of node names to run lists
+func NewRoleGraph(roles map[string]*Role, nodes map[string][]string) *RoleGraph {
+	graph := &RoleGraph{Includes: map[string][]string{}, Nodes: map[string][]string{}}
+	missing := map[string]string{}
+	check := func(names []string) {
+		for _, name := range names {
+			if roles[name] == nil {
+				missing[name] = name
+			}
+		}
+	}
+
+	for name, role := range roles {
+		runLists := [][]string{role.RunList}
+		for _, runList := range role.EnvRunLists {
+			runLists = append(runLists, runList)
+		}
+		graph.Includes[name] = runListRoles(runLists...)
+		check(graph.Includes[name])
+	}
+	for name, runList := range nodes {
+		graph.Nodes[name] = runListRoles(runList)
+		check(graph.Nodes[name])
+	}
+	graph.Missing = sortedKeys(missing)
+	return graph
+}
+
+// chef.GetRoleGraph builds the graph of all the roles on the server and of
+// the run lists of all the nodes.
+//
+// Usage:
+//
+//     graph, err := chef.GetRoleGraph()
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, cycle := range graph.Cycles() {
+//         fmt.Println("cycle:", strings.Join(cycle, " -> "))
+//     }
+//     for _, node := range graph.Dependents("base").Nodes {
+//         fmt.Println(strings.Join(node.Path, " -> "))
+//     }
+func (chef *Chef) GetRoleGraph() (*RoleGraph, error) {
+	names, err := chef.GetRoles()
+	if err != nil {
+		return nil, err
+	}
+	roles := map[string]*Role{}
+	for name := range names {
+		role, ok, err := chef.GetRole(name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			roles[name] = role
+		}
+	}
+
+	nodes := map[string][]string{}
+	err = chef.searchAll("node", "*:*", func(row json.RawMessage) error {
+		var node struct {
+			Name    string   `json:"name"`
+			RunList []string `json:"run_list"`
+		}
+		if err := json.Unmarshal(row, &node); err != nil {
+			return err
+		}
+		nodes[node.Name] = node.RunList
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRoleGraph(roles, nodes), nil
+}
+
+// roleNames returns the sorted names of the existing roles
+func (g *RoleGraph) roleNames() []string {
+	names := []string{}
+	for name := range g.Includes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Cycles returns the cycles of role inclusions, each one as the list of roles
+// starting and ending with the same role, e.g. [a b a]. Each cycle is reported
+// once, starting from its alphabetically first role.
+func (g *RoleGraph) Cycles() [][]string {
+	return graphCycles(g.Includes, g.roleNames())
+}
+
+// graphCycles finds the cycles of a directed graph given as a map of vertices
+// to the vertices they point to, visiting the vertices in the supplied order
+func graphCycles(edges map[string][]string, names []string) [][]string {
+	cycles := [][]string{}
+	seen := map[string]bool{}
+	state := map[string]int{} // 1 while on the stack, 2 once done
+	stack := []string{}
+
+	var visit func(string)
+	visit = func(name string) {
+		state[name] = 1
+		stack = append(stack, name)
+		for _, next := range edges[name] {
+			switch state[next] {
+			case 0:
+				visit(next)
+			case 1:
+				start := 0
+				for stack[start] != next {
+					start++
+				}
+				cycle := rotateCycle(stack[start:])
+				key := strings.Join(cycle, " ")
+				if !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, cycle)
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = 2
+	}
+	for _, name := range names {
+		if state[name] == 0 {
+			visit(name)
+		}
+	}
+	return cycles
+}
+
+// rotateCycle rotates a cycle so it starts with its smallest vertex and
+// closes it by repeating that vertex at the end
+func rotateCycle(names []string) []string {
+	first := 0
+	for i, name := range names {
+		if name < names[first] {
+			first = i
+		}
+	}
+	cycle := append(append([]string{}, names[first:]...), names[:first]...)
+	return append(cycle, cycle[0])
+}
+
+// Depths returns, for every role, how deeply roles are nested below it: 0 for
+// a role which doesn't include any role, 1 for a role which only includes
+// such roles, and so on. Inclusions which close a cycle are ignored.
+func (g *RoleGraph) Depths() map[string]int {
+	depths := map[string]int{}
+	onStack := map[string]bool{}
+
+	var depth func(string) int
+	depth = func(name string) int {
+		if d, ok := depths[name]; ok {
+			return d
+		}
+		onStack[name] = true
+		d := 0
+		for _, included := range g.Includes[name] {
+			if onStack[included] {
+				continue
+			}
+			// missing roles don't include anything
+			below := 0
+			if _, ok := g.Includes[included]; ok {
+				below = depth(included)
+			}
+			if below+1 > d {
+				d = below + 1
+			}
+		}
+		onStack[name] = false
+		depths[name] = d
+		return d
+	}
+	for _, name := range g.roleNames() {
+		depth(name)
+	}
+	return depths
+}
+
+// Dependents returns the roles and nodes which use the named role, directly
+// or transitively, sorted by name, along with the shortest chain of
+// references leading to it. This is what an edit of the role can break.
+func (g *RoleGraph) Dependents(name string) *RoleDependents {
+	includedBy := map[string][]string{}
+	for role, includes := range g.Includes {
+		for _, included := range includes {
+			includedBy[included] = append(includedBy[included], role)
+		}
+	}
+
+	// breadth first from the role up to the roles including it, keeping the
+	// path to the role
+	paths := map[string][]string{name: {name}}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		parents := includedBy[current]
+		sort.Strings(parents)
+		for _, parent := range parents {
+			if _, ok := paths[parent]; ok {
+				continue
+			}
+			paths[parent] = append([]string{parent}, paths[current]...)
+			queue = append(queue, parent)
+		}
+	}
+
+	dependents := &RoleDependents{Roles: []RoleDependent{}, Nodes: []RoleDependent{}}
+	for _, role := range g.roleNames() {
+		if path, ok := paths[role]; ok && role != name {
+			dependents.Roles = append(dependents.Roles, RoleDependent{Name: role, Path: path})
+		}
+	}
+
+	nodes := []string{}
+	for node := range g.Nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		var shortest []string
+		for _, role := range g.Nodes[node] {
+			if path, ok := paths[role]; ok && (shortest == nil || len(path) < len(shortest)) {
+				shortest = path
+			}
+		}
+		if shortest != nil {
+			path := append([]string{node}, shortest...)
+			dependents.Nodes = append(dependents.Nodes, RoleDependent{Name: node, Path: path})
+		}
+	}
+	return dependents
+}
+
+// Unused returns the roles which no node uses, directly or through other
+// roles. A role only included by unused roles is unused as well.
+func (g *RoleGraph) Unused() []string {
+	used := map[string]bool{}
+	var use func(string)
+	use = func(name string) {
+		if used[name] {
+			return
+		}
+		used[name] = true
+		for _, included := range g.Includes[name] {
+			use(included)
+		}
+	}
+	for _, roles := range g.Nodes {
+		for _, role := range roles {
+			use(role)
+		}
+	}
+
+	unused := []string{}
+	for _, name := range g.roleNames() {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	return unused
+}
+
+// DOT returns the graph in the Graphviz DOT format. Roles are ellipses, nodes
+// are boxes and missing roles are drawn in red.
+//
+// Usage:
+//
+//     ioutil.WriteFile("roles.dot", []byte(graph.DOT()), 0644)
+//     // dot -Tsvg roles.dot > roles.svg
+func (g *RoleGraph) DOT() string {
+	var dot strings.Builder
+	dot.WriteString("digraph roles {\n")
+	for _, name := range g.roleNames() {
+		fmt.Fprintf(&dot, "  %q [shape=ellipse];\n", "role["+name+"]")
+	}
+	for _, name := range g.Missing {
+		fmt.Fprintf(&dot, "  %q [shape=ellipse, color=red];\n", "role["+name+"]")
+	}
+	nodes := []string{}
+	for node := range g.Nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		fmt.Fprintf(&dot, "  %q [shape=box];\n", node)
+	}
+	for _, name := range g.roleNames() {
+		for _, included := range g.Includes[name] {
+			fmt.Fprintf(&dot, "  %q -> %q;\n", "role["+name+"]", "role["+included+"]")
+		}
+	}
+	for _, node := range nodes {
+		for _, role := range g.Nodes[node] {
+			fmt.Fprintf(&dot, "  %q -> %q;\n", node, "role["+role+"]")
+		}
+	}
+	dot.WriteString("}\n")
+	return dot.String()
+}
+
+// JSON returns the graph along with the depth of every role, the cycles and
+// the unused roles as indented JSON
+func (g *RoleGraph) JSON() ([]byte, error) {
+	type roleJSON struct {
+		Includes []string `json:"includes"`
+		Depth    int      `json:"depth"`
+	}
+	depths := g.Depths()
+	roles := map[string]roleJSON{}
+	for name, includes := range g.Includes {
+		roles[name] = roleJSON{Includes: includes, Depth: depths[name]}
+	}
+	missing := g.Missing
+	if missing == nil {
+		missing = []string{}
+	}
+	return json.MarshalIndent(struct {
+		Roles   map[string]roleJSON `json:"roles"`
+		Nodes   map[string][]string `json:"nodes"`
+		Missing []string            `json:"missing"`
+		Cycles  [][]string          `json:"cycles"`
+		Unused  []string            `json:"unused"`
+	}{roles, g.Nodes, missing, g.Cycles(), g.Unused()}, "", "  ")
+}
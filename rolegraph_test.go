@@ -0,0 +1,126 @@
+package chef
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testRoleGraph() *RoleGraph {
+	roles := map[string]*Role{
+		"base":      {RunList: []string{"recipe[ntp]"}},
+		"webserver": {RunList: []string{"role[base]", "recipe[apache2]"}},
+		"frontend": {
+			RunList:     []string{"role[webserver]"},
+			EnvRunLists: map[string][]string{"production": {"role[webserver]", "role[monitoring]"}},
+		},
+		"legacy": {RunList: []string{"role[base]"}},
+		"a":      {RunList: []string{"role[b]"}},
+		"b":      {RunList: []string{"role[c]"}},
+		"c":      {RunList: []string{"role[a]", "role[base]"}},
+	}
+	nodes := map[string][]string{
+		"web1": {"role[frontend]"},
+		"db1":  {"role[base]", "recipe[mysql]"},
+		"misc": {"role[c]"},
+	}
+	return NewRoleGraph(roles, nodes)
+}
+
+func TestRoleGraph(t *testing.T) {
+	graph := testRoleGraph()
+
+	if !reflect.DeepEqual(graph.Missing, []string{"monitoring"}) {
+		t.Errorf("unexpected missing roles %v", graph.Missing)
+	}
+	if !reflect.DeepEqual(graph.Includes["frontend"], []string{"monitoring", "webserver"}) {
+		t.Errorf("environment run lists should be included %v", graph.Includes["frontend"])
+	}
+
+	cycles := graph.Cycles()
+	if !reflect.DeepEqual(cycles, [][]string{{"a", "b", "c", "a"}}) {
+		t.Errorf("unexpected cycles %v", cycles)
+	}
+
+	depths := graph.Depths()
+	expected := map[string]int{"base": 0, "webserver": 1, "frontend": 2, "legacy": 1}
+	for name, depth := range expected {
+		if depths[name] != depth {
+			t.Errorf("unexpected depth %d for %s", depths[name], name)
+		}
+	}
+
+	if unused := graph.Unused(); !reflect.DeepEqual(unused, []string{"legacy"}) {
+		t.Errorf("unexpected unused roles %v", unused)
+	}
+}
+
+func TestRoleGraphDependents(t *testing.T) {
+	dependents := testRoleGraph().Dependents("base")
+
+	roles := []string{}
+	for _, role := range dependents.Roles {
+		roles = append(roles, strings.Join(role.Path, " "))
+	}
+	expected := []string{"a b c base", "b c base", "c base", "frontend webserver base", "legacy base", "webserver base"}
+	if !reflect.DeepEqual(roles, expected) {
+		t.Errorf("unexpected dependent roles %v", roles)
+	}
+
+	nodes := []string{}
+	for _, node := range dependents.Nodes {
+		nodes = append(nodes, strings.Join(node.Path, " "))
+	}
+	expected = []string{"db1 base", "misc c base", "web1 frontend webserver base"}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("unexpected dependent nodes %v", nodes)
+	}
+	if !dependents.Nodes[0].Direct() || dependents.Nodes[1].Direct() {
+		t.Error("only db1 uses base directly")
+	}
+}
+
+func TestRoleGraphExport(t *testing.T) {
+	graph := testRoleGraph()
+
+	dot := graph.DOT()
+	for _, line := range []string{
+		`"role[webserver]" -> "role[base]";`,
+		`"web1" -> "role[frontend]";`,
+		`"role[monitoring]" [shape=ellipse, color=red];`,
+	} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("DOT output is missing %s", line)
+		}
+	}
+
+	data, err := graph.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Roles map[string]struct {
+			Depth int `json:"depth"`
+		} `json:"roles"`
+		Unused []string `json:"unused"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Roles["frontend"].Depth != 2 || len(decoded.Unused) != 1 {
+		t.Errorf("unexpected JSON %s", data)
+	}
+}
+
+func TestGetRoleGraph(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	graph, err := chef.GetRoleGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := graph.Includes[config.RequiredRole.Name]; !ok {
+		t.Error("Required role not found in the graph")
+	}
+}
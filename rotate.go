@@ -0,0 +1,263 @@
+package chef
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// chef.RotationOptions configure an encrypted data bag secret rotation. Bags
+// lists the data bags to rotate, all of them if empty. Version is the format
+// version the items are re-encrypted with, 3 if not set. LogFile is the path
+// of the progress log: every item which has been handled is appended to it,
+// and items already listed in it are skipped, so an interrupted rotation can
+// be resumed by running it again with the same log. Use a new log for every
+// rotation.
+type RotationOptions struct {
+	Bags      []string
+	OldSecret []byte
+	NewSecret []byte
+	Version   int
+	LogFile   string
+}
+
+// chef.RotationResult lists the items, as "bag/id", handled by a rotation.
+// Rotated items were re-encrypted, AlreadyRotated ones were already encrypted
+// with the new secret and Skipped ones aren't encrypted with a shared secret,
+// such as plain items and chef-vault items.
+type RotationResult struct {
+	Rotated        []string
+	AlreadyRotated []string
+	Skipped        []string
+}
+
+// the statuses of an item in the progress log
+const (
+	rotationRotated        = "rotated"
+	rotationAlreadyRotated = "already-rotated"
+	rotationSkipped        = "skipped"
+)
+
+// chef.RotateDataBagSecret re-encrypts the encrypted items of data bags with
+// a new secret. Each item is decrypted with the old secret, encrypted with the
+// new one, written, and read back to check that it decrypts to the same
+// content before moving on. Items which already decrypt with the new secret
+// are left alone, which makes running a rotation again safe. The rotation
+// stops at the first item which fails, with an error naming it; fix the
+// problem and run it again with the same log to resume.
+//
+// Usage:
+//
+//     oldSecret, _ := chef.ReadEncryptedDataBagSecret("/etc/chef/encrypted_data_bag_secret")
+//     newSecret, _ := chef.ReadEncryptedDataBagSecret("new_secret")
+//     result, err := c.RotateDataBagSecret(chef.RotationOptions{
+//         OldSecret: oldSecret,
+//         NewSecret: newSecret,
+//         LogFile:   "rotation.log",
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println(len(result.Rotated), "items rotated")
+func (chef *Chef) RotateDataBagSecret(options RotationOptions) (*RotationResult, error) {
+	if len(options.OldSecret) == 0 || len(options.NewSecret) == 0 {
+		return nil, errors.New("both the old and the new secrets are needed")
+	}
+	if options.Version == 0 {
+		options.Version = 3
+	}
+	if options.LogFile == "" {
+		return nil, errors.New("a progress log file is needed")
+	}
+
+	done, err := readRotationLog(options.LogFile)
+	if err != nil {
+		return nil, err
+	}
+	log, err := os.OpenFile(options.LogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer log.Close()
+
+	bags := options.Bags
+	if len(bags) == 0 {
+		all, err := chef.GetData()
+		if err != nil {
+			return nil, err
+		}
+		bags = sortedKeys(all)
+	}
+
+	result := &RotationResult{Rotated: []string{}, AlreadyRotated: []string{}, Skipped: []string{}}
+	record := func(name, status string) error {
+		switch status {
+		case rotationRotated:
+			result.Rotated = append(result.Rotated, name)
+		case rotationAlreadyRotated:
+			result.AlreadyRotated = append(result.AlreadyRotated, name)
+		case rotationSkipped:
+			result.Skipped = append(result.Skipped, name)
+		}
+		if _, ok := done[name]; ok {
+			return nil
+		}
+		if _, err := fmt.Fprintf(log, "%s\t%s\n", status, name); err != nil {
+			return err
+		}
+		return log.Sync()
+	}
+
+	for _, bag := range bags {
+		items, ok, err := chef.GetDataByName(bag)
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			return result, fmt.Errorf("data bag %s not found", bag)
+		}
+
+		for _, id := range sortedKeys(items) {
+			name := bag + "/" + id
+			if status, ok := done[name]; ok {
+				record(name, status)
+				continue
+			}
+			// chef-vault items have their own secrets
+			_, isVaultItem := items[id+"_keys"]
+			if isVaultItem || (strings.HasSuffix(id, "_keys") && items[strings.TrimSuffix(id, "_keys")] != "") {
+				if err := record(name, rotationSkipped); err != nil {
+					return result, err
+				}
+				continue
+			}
+
+			status, err := chef.rotateDataBagItem(bag, id, options)
+			if err != nil {
+				return result, fmt.Errorf("rotating %s: %s", name, err)
+			}
+			if err := record(name, status); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// rotateDataBagItem re-encrypts a single item and checks the result
+func (chef *Chef) rotateDataBagItem(bag, id string, options RotationOptions) (string, error) {
+	stored, ok, err := chef.GetDataBagItem(bag, id)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errors.New("item not found")
+	}
+
+	item, rotated, err := reencryptDataBagItem(stored, options.OldSecret, options.NewSecret, options.Version)
+	if err == ErrDataBagItemNotEncrypted {
+		return rotationSkipped, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if rotated == nil {
+		return rotationAlreadyRotated, nil
+	}
+
+	_, err = chef.UpdateDataBagItem(bag, id, func(stored DataBagItem) error {
+		replaceDataBagItem(stored, rotated)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	written, ok, err := chef.GetDataBagItem(bag, id)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errors.New("item disappeared after being written")
+	}
+	if err := checkRotatedDataBagItem(written, item, options.NewSecret); err != nil {
+		return "", err
+	}
+	return rotationRotated, nil
+}
+
+// reencryptDataBagItem decrypts an item with the old secret and encrypts it
+// with the new one. It returns the decrypted item and the re-encrypted one,
+// which is nil if the item was already encrypted with the new secret and the
+// given format version.
+func reencryptDataBagItem(stored DataBagItem, oldSecret, newSecret []byte, version int) (DataBagItem, DataBagItem, error) {
+	current, err := EncryptedDataBagItemVersion(stored)
+	if err != nil {
+		return nil, nil, err
+	}
+	item, err := DecryptDataBagItem(stored, newSecret)
+	if err == nil && current == version {
+		return item, nil, nil
+	}
+	if err != nil {
+		if item, err = DecryptDataBagItem(stored, oldSecret); err != nil {
+			return nil, nil, fmt.Errorf("can't be decrypted with either secret: %s", err)
+		}
+	}
+	rotated, err := EncryptDataBagItem(item, newSecret, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	return item, rotated, nil
+}
+
+// checkRotatedDataBagItem checks that an item read back from the server
+// decrypts to the expected content with the new secret
+func checkRotatedDataBagItem(written, expected DataBagItem, secret []byte) error {
+	decrypted, err := DecryptDataBagItem(written, secret)
+	if err != nil {
+		return fmt.Errorf("written item can't be decrypted: %s", err)
+	}
+	// compare the JSON representations, numbers may not have the same type
+	a, _ := json.Marshal(decrypted)
+	b, _ := json.Marshal(expected)
+	var x, y interface{}
+	json.Unmarshal(a, &x)
+	json.Unmarshal(b, &y)
+	if !reflect.DeepEqual(x, y) {
+		return errors.New("written item doesn't match the original")
+	}
+	return nil
+}
+
+// readRotationLog reads a progress log into a map of "bag/id" to status. A
+// missing log is an empty one.
+func readRotationLog(path string) (map[string]string, error) {
+	done := map[string]string{}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(content), "\n")
+	// the last line is either empty or was cut short by a crash
+	for _, line := range lines[:len(lines)-1] {
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case rotationRotated, rotationAlreadyRotated, rotationSkipped:
+			done[fields[1]] = fields[0]
+		}
+	}
+	return done, nil
+}
@@ -0,0 +1,133 @@
+package chef
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReencryptDataBagItem(t *testing.T) {
+	oldSecret := []byte("chef_golang_test_secret")
+	newSecret := []byte("new secret")
+	stored := readTestEncryptedItem(t, 1)
+
+	item, rotated, err := reencryptDataBagItem(stored, oldSecret, newSecret, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := EncryptedDataBagItemVersion(rotated); v != 3 {
+		t.Errorf("item should be encrypted with version 3, not %d", v)
+	}
+	if err := checkRotatedDataBagItem(rotated, item, newSecret); err != nil {
+		t.Error(err)
+	}
+	if err := checkRotatedDataBagItem(rotated, item, oldSecret); err == nil {
+		t.Error("the rotated item shouldn't decrypt with the old secret")
+	}
+	if err := checkRotatedDataBagItem(rotated, DataBagItem{"id": "mysql"}, newSecret); err == nil {
+		t.Error("a content mismatch should be reported")
+	}
+
+	// running again finds the item already rotated
+	_, again, err := reencryptDataBagItem(rotated, oldSecret, newSecret, 3)
+	if err != nil || again != nil {
+		t.Errorf("item should be reported as already rotated: %v", err)
+	}
+
+	// an item already encrypted with the new secret is upgraded to the
+	// requested format version
+	_, upgraded, err := reencryptDataBagItem(stored, []byte("wrong"), oldSecret, 3)
+	if err != nil || upgraded == nil {
+		t.Fatalf("item should be re-encrypted with version 3: %v", err)
+	}
+	if v, _ := EncryptedDataBagItemVersion(upgraded); v != 3 {
+		t.Errorf("item should be encrypted with version 3, not %d", v)
+	}
+	if err := checkRotatedDataBagItem(upgraded, item, oldSecret); err != nil {
+		t.Error(err)
+	}
+
+	if _, _, err := reencryptDataBagItem(stored, []byte("wrong"), newSecret, 3); err == nil {
+		t.Error("items which can't be decrypted should be reported")
+	}
+	plain := DataBagItem{"id": "plain", "value": "x"}
+	if _, _, err := reencryptDataBagItem(plain, oldSecret, newSecret, 3); err != ErrDataBagItemNotEncrypted {
+		t.Error("plain items should be reported as not encrypted")
+	}
+}
+
+func TestReadRotationLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chef-rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rotation.log")
+
+	done, err := readRotationLog(path)
+	if err != nil || len(done) != 0 {
+		t.Fatal("a missing log should be empty", err)
+	}
+
+	content := "rotated\tpasswords/mysql\nskipped\tpasswords/app_keys\nalready-rotated\tapi/token\nrotated\tapi/tok"
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	done, err = readRotationLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"passwords/mysql":    "rotated",
+		"passwords/app_keys": "skipped",
+		"api/token":          "already-rotated",
+	}
+	if !reflect.DeepEqual(done, expected) {
+		t.Errorf("unexpected log %v", done)
+	}
+}
+
+func TestRotateDataBagSecret(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	bag := "chef_golang_rotation_test"
+	oldSecret := []byte("old secret")
+	newSecret := []byte("new secret")
+
+	if err := chef.CreateDataBag(bag); err != nil {
+		t.Fatal(err)
+	}
+	defer chef.DeleteDataBag(bag)
+	encrypted, err := EncryptDataBagItem(DataBagItem{"id": "token", "value": "abc"}, oldSecret, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chef.CreateDataBagItem(bag, encrypted); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "chef-rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	options := RotationOptions{
+		Bags:      []string{bag},
+		OldSecret: oldSecret,
+		NewSecret: newSecret,
+		LogFile:   filepath.Join(dir, "rotation.log"),
+	}
+	result, err := chef.RotateDataBagSecret(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rotated) != 1 {
+		t.Errorf("unexpected result %v", result)
+	}
+
+	item, ok, err := chef.GetEncryptedDataBagItem(bag, "token", newSecret)
+	if err != nil || !ok || item["value"] != "abc" {
+		t.Error("item wasn't rotated", err)
+	}
+}
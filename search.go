@@ -1,7 +1,9 @@
 package chef
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 )
@@ -85,20 +87,143 @@ func (chef *Chef) Search(index, query string) (*SearchResults, error) {
 	return chef.NewSearchQuery(index, query).Execute()
 }
 
+// chef.SearchOptions are the optional parameters of a Chef search query. Rows
+// is the number of results to return, the server's default if 0, Start the
+// offset of the first one, and Sort a sort order such as "name asc".
+type SearchOptions struct {
+	Sort  string
+	Rows  int
+	Start int
+}
+
 // chef.SearchWithParams is similar to chef.Search, but you can define
 // additional Chef search parameters
-func (chef *Chef) SearchWithParams(index, query string, params map[string]interface{}) (*SearchResults, error) {
-	searchParams := chef.NewSearchQuery(index, query)
-	if params["rows"] != nil {
-		searchParams.Rows = params["rows"].(int)
+//
+// Usage:
+//
+//     results, err := chef.SearchWithParams("node", "role:web", chef.SearchOptions{
+//         Sort: "name asc",
+//         Rows: 50,
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) SearchWithParams(index, query string, options SearchOptions) (*SearchResults, error) {
+	return chef.newSearchQueryWithOptions(index, query, options).Execute()
+}
+
+// newSearchQueryWithOptions returns the search parameters of a query with the
+// given options
+func (chef *Chef) newSearchQueryWithOptions(index, query string, options SearchOptions) *SearchParams {
+	search := chef.NewSearchQuery(index, query)
+	if options.Rows > 0 {
+		search.Rows = options.Rows
+	}
+	if options.Start > 0 {
+		search.Start = options.Start
+	}
+	search.Sort = options.Sort
+	return search
+}
+
+// chef.SearchNodes runs a search query on the node index and returns the
+// matching nodes along with the total number of results, which is more than
+// the number of nodes returned when options.Rows limits them.
+//
+// Usage:
+//
+//     nodes, total, err := chef.SearchNodes("role:web", chef.SearchOptions{})
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println(len(nodes), "of", total, "nodes")
+func (chef *Chef) SearchNodes(query string, options SearchOptions) ([]Node, int, error) {
+	return searchAs[Node](chef, "node", query, options)
+}
+
+// chef.SearchRoles runs a search query on the role index and returns the
+// matching roles along with the total number of results.
+//
+// Usage:
+//
+//     roles, total, err := chef.SearchRoles("run_list:recipe\\[nginx\\]", chef.SearchOptions{})
+func (chef *Chef) SearchRoles(query string, options SearchOptions) ([]Role, int, error) {
+	return searchAs[Role](chef, "role", query, options)
+}
+
+// chef.SearchEnvironments runs a search query on the environment index and
+// returns the matching environments along with the total number of results.
+//
+// Usage:
+//
+//     environments, total, err := chef.SearchEnvironments("name:prod*", chef.SearchOptions{})
+func (chef *Chef) SearchEnvironments(query string, options SearchOptions) ([]Environment, int, error) {
+	return searchAs[Environment](chef, "environment", query, options)
+}
+
+// chef.SearchClients runs a search query on the client index and returns the
+// matching clients along with the total number of results.
+//
+// Usage:
+//
+//     clients, total, err := chef.SearchClients("validator:true", chef.SearchOptions{})
+func (chef *Chef) SearchClients(query string, options SearchOptions) ([]Client, int, error) {
+	return searchAs[Client](chef, "client", query, options)
+}
+
+// chef.SearchDataBag runs a search query on a data bag and decodes each
+// matching item into a T, along with the total number of results.
+//
+// Usage:
+//
+//     type user struct {
+//         ID    string `json:"id"`
+//         Shell string `json:"shell"`
+//     }
+//     users, total, err := chef.SearchDataBag[user](c, "users", "shell:*zsh", chef.SearchOptions{})
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func SearchDataBag[T any](chef *Chef, bag, query string, options SearchOptions) ([]T, int, error) {
+	if !dataBagNameRegexp.MatchString(bag) {
+		return nil, 0, fmt.Errorf("invalid data bag name '%s'", bag)
 	}
-	if params["start"] != nil {
-		searchParams.Start = params["start"].(int)
+	return searchAs[T](chef, bag, query, options)
+}
+
+// searchAs runs a search query and decodes each row of its results into a T
+func searchAs[T any](chef *Chef, index, query string, options SearchOptions) ([]T, int, error) {
+	results, err := chef.SearchWithParams(index, query, options)
+	if err != nil {
+		return nil, 0, err
 	}
-	if params["sort"] != nil {
-		searchParams.Sort = params["sort"].(string)
+	rows, err := decodeSearchRows[T](results)
+	if err != nil {
+		return nil, 0, err
 	}
-	return searchParams.Execute()
+	return rows, results.Total, nil
+}
+
+// decodeSearchRows decodes each row of search results into a T. Data bag
+// items, which the server wraps in a Chef::DataBagItem object, are unwrapped.
+func decodeSearchRows[T any](results *SearchResults) ([]T, error) {
+	rows := make([]T, len(results.Rows))
+	for i, row := range results.Rows {
+		var wrapped struct {
+			JSONClass string          `json:"json_class"`
+			RawData   json.RawMessage `json:"raw_data"`
+		}
+		if json.Unmarshal(row, &wrapped) == nil && wrapped.JSONClass == "Chef::DataBagItem" && wrapped.RawData != nil {
+			row = wrapped.RawData
+		}
+		if err := json.Unmarshal(row, &rows[i]); err != nil {
+			return nil, fmt.Errorf("search row %d: %s", results.Start+i, err)
+		}
+	}
+	return rows, nil
 }
 
 // chef.Execute is a method on the chef.SearchParams type that executes a given
@@ -106,6 +231,103 @@ func (chef *Chef) SearchWithParams(index, query string, params map[string]interf
 // chef.Search method, but you can call it yourself if you'd like some more
 // control over your parameters
 func (search *SearchParams) Execute() (*SearchResults, error) {
+	resp, err := search.chef.GetWithParams(fmt.Sprintf("search/%s", search.Index), search.queryParams())
+	if err != nil {
+		return nil, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	results := new(SearchResults)
+	json.Unmarshal(body, results)
+
+	return results, nil
+}
+
+// chef.PartialSearchKeys maps the keys of partial search results to the
+// attribute paths their values are read from, such as
+// {"kernel": {"kernel", "release"}} for node["kernel"]["release"]
+type PartialSearchKeys map[string][]string
+
+// chef.ExecutePartial is like chef.Execute, but runs a partial search: only
+// the attributes listed in keys are returned, which is much lighter than
+// whole objects. Each row of the results is a JSON object with the given keys,
+// missing attributes being null.
+//
+// Usage:
+//
+//     search := chef.NewSearchQuery("node", "role:web")
+//     results, err := search.ExecutePartial(chef.PartialSearchKeys{
+//         "name": {"name"},
+//         "ip":   {"ipaddress"},
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     for _, row := range results.Rows {
+//         fmt.Println(string(row))
+//     }
+func (search *SearchParams) ExecutePartial(keys PartialSearchKeys) (*SearchResults, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("a partial search needs at least one key")
+	}
+	payload, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := search.chef.Post(fmt.Sprintf("search/%s", search.Index), "application/json", search.queryParams(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	return parsePartialSearchResults(body)
+}
+
+// chef.PartialSearch is similar to chef.Search, but only returns the
+// attributes listed in keys for each result, see chef.ExecutePartial
+func (chef *Chef) PartialSearch(index, query string, keys PartialSearchKeys) (*SearchResults, error) {
+	return chef.NewSearchQuery(index, query).ExecutePartial(keys)
+}
+
+// chef.PartialSearchAs runs a partial search and decodes each row into a T,
+// whose JSON field names are the keys of the partial search. It also returns
+// the total number of results, which is more than the number of rows when
+// search.Rows limits them.
+//
+// Usage:
+//
+//     type host struct {
+//         Name string `json:"name"`
+//         IP   string `json:"ip"`
+//     }
+//     hosts, total, err := chef.PartialSearchAs[host](c.NewSearchQuery("node", "role:web"), chef.PartialSearchKeys{
+//         "name": {"name"},
+//         "ip":   {"ipaddress"},
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func PartialSearchAs[T any](search *SearchParams, keys PartialSearchKeys) ([]T, int, error) {
+	results, err := search.ExecutePartial(keys)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := decodeSearchRows[T](results)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rows, results.Total, nil
+}
+
+// queryParams returns the query string parameters of a search
+func (search *SearchParams) queryParams() map[string]string {
 	params := map[string]string{
 		"q": search.Query,
 	}
@@ -118,17 +340,39 @@ func (search *SearchParams) Execute() (*SearchResults, error) {
 	if search.Sort != "" {
 		params["sort"] = search.Sort
 	}
-	resp, err := search.chef.GetWithParams(fmt.Sprintf("search/%s", search.Index), params)
-	if err != nil {
-		return nil, err
+	return params
+}
+
+// parsePartialSearchResults decodes partial search results, whose rows are
+// {"url": ..., "data": {...}} objects, into results whose rows are the data
+func parsePartialSearchResults(body []byte) (*SearchResults, error) {
+	var partial struct {
+		Total int `json:"total"`
+		Start int `json:"start"`
+		Rows  []struct {
+			URL  string          `json:"url"`
+			Data json.RawMessage `json:"data"`
+		} `json:"rows"`
 	}
-	body, err := responseBody(resp)
-	if err != nil {
+	if err := json.Unmarshal(body, &partial); err != nil {
 		return nil, err
 	}
-
-	results := new(SearchResults)
-	json.Unmarshal(body, results)
-
+	results := &SearchResults{Total: partial.Total, Start: partial.Start, Rows: []json.RawMessage{}}
+	for _, row := range partial.Rows {
+		results.Rows = append(results.Rows, row.Data)
+	}
 	return results, nil
 }
+
+// searchAll runs a search query page by page and hands every row of the
+// results to the supplied function
+func (chef *Chef) searchAll(index, query string, each func(json.RawMessage) error) error {
+	it := chef.NewSearchQuery(index, query).Iterator(DefaultSearchPageSize, false)
+	defer it.Close()
+	for it.Next() {
+		if err := each(it.Row()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
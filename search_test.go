@@ -1,6 +1,7 @@
 package chef
 
 import (
+	"encoding/json"
 	"testing"
 )
 
@@ -31,7 +32,63 @@ func TestSearch(t *testing.T) {
 	}
 }
 
-func TestSearchWithParams(t *testing.T) {}
+func TestSearchWithParams(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	results, err := chef.SearchWithParams(config.SearchData.Index, config.SearchData.Query, SearchOptions{Rows: 1, Sort: "name asc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Rows) > 1 {
+		t.Errorf("expected at most 1 row, got %d", len(results.Rows))
+	}
+}
+
+func TestNewSearchQueryWithOptions(t *testing.T) {
+	search := (&Chef{}).newSearchQueryWithOptions("node", "*:*", SearchOptions{})
+	if search.Rows != -1 || search.Start != -1 || search.Sort != "" {
+		t.Errorf("unexpected search %v", search)
+	}
+	search = (&Chef{}).newSearchQueryWithOptions("node", "*:*", SearchOptions{Rows: 10, Start: 20, Sort: "name asc"})
+	if search.Rows != 10 || search.Start != 20 || search.Sort != "name asc" {
+		t.Errorf("unexpected search %v", search)
+	}
+}
+
+func TestDecodeSearchRows(t *testing.T) {
+	results := &SearchResults{Total: 2, Rows: []json.RawMessage{
+		json.RawMessage(`{"name": "data_bag_item_users_jdoe", "json_class": "Chef::DataBagItem", "chef_type": "data_bag_item", "data_bag": "users", "raw_data": {"id": "jdoe", "shell": "/bin/zsh"}}`),
+		json.RawMessage(`{"id": "asmith", "shell": "/bin/bash"}`),
+	}}
+	type user struct {
+		ID    string `json:"id"`
+		Shell string `json:"shell"`
+	}
+	users, err := decodeSearchRows[user](results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0] != (user{"jdoe", "/bin/zsh"}) || users[1] != (user{"asmith", "/bin/bash"}) {
+		t.Errorf("unexpected users %v", users)
+	}
+
+	results.Rows = []json.RawMessage{json.RawMessage(`{"id": 42}`)}
+	if _, err := decodeSearchRows[user](results); err == nil {
+		t.Error("a row of the wrong type should be an error")
+	}
+}
+
+func TestSearchNodes(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	nodes, total, err := chef.SearchNodes("name:"+config.RequiredNode.Name, SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(nodes) != 1 || nodes[0].Name != config.RequiredNode.Name {
+		t.Errorf("unexpected nodes %v", nodes)
+	}
+}
 
 func TestNewSearchQuery(t *testing.T) {
 	chef := testConnectionWrapper(t)
@@ -44,3 +101,54 @@ func TestNewSearchQuery(t *testing.T) {
 		t.Error("Search query isn't correctly set")
 	}
 }
+
+func TestSearchQueryParams(t *testing.T) {
+	search := (&Chef{}).NewSearchQuery("node", "role:web")
+	params := search.queryParams()
+	if len(params) != 1 || params["q"] != "role:web" {
+		t.Errorf("unexpected params %v", params)
+	}
+	search.Rows = 50
+	search.Start = 100
+	search.Sort = "name asc"
+	params = search.queryParams()
+	if params["rows"] != "50" || params["start"] != "100" || params["sort"] != "name asc" {
+		t.Errorf("unexpected params %v", params)
+	}
+}
+
+func TestParsePartialSearchResults(t *testing.T) {
+	body := `{"total": 3, "start": 1, "rows": [
+		{"url": "https://chef/nodes/web1", "data": {"name": "web1", "ip": "10.0.0.1"}},
+		{"url": "https://chef/nodes/web2", "data": {"name": "web2", "ip": null}}
+	]}`
+	results, err := parsePartialSearchResults([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Total != 3 || results.Start != 1 || len(results.Rows) != 2 {
+		t.Fatalf("unexpected results %v", results)
+	}
+	if string(results.Rows[1]) != `{"name": "web2", "ip": null}` {
+		t.Errorf("unexpected row %s", results.Rows[1])
+	}
+}
+
+func TestPartialSearchAs(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	type node struct {
+		Name        string `json:"name"`
+		Environment string `json:"environment"`
+	}
+	nodes, total, err := PartialSearchAs[node](chef.NewSearchQuery("node", "name:"+config.RequiredNode.Name), PartialSearchKeys{
+		"name":        {"name"},
+		"environment": {"chef_environment"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(nodes) != 1 || nodes[0].Name != config.RequiredNode.Name {
+		t.Errorf("unexpected results %v", nodes)
+	}
+}
@@ -0,0 +1,382 @@
+package chef
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// DefaultSearchPageSize is the number of rows a search iterator requests at
+// once when no page size is given
+const DefaultSearchPageSize = 1000
+
+// ErrSearchResultsChanged is returned by a search iterator when the results
+// changed between two pages, for example because a node was added or deleted
+// in the meantime. Rows may have been missed or seen twice; start over to get
+// a consistent view.
+var ErrSearchResultsChanged = errors.New("search results changed during iteration")
+
+// chef.SearchIterator pages through all the results of a search, decoding rows
+// one at a time as they are read from the server. It's used like a
+// bufio.Scanner.
+//
+// Usage:
+//
+//     it := c.NewSearchQuery("node", "role:web").Iterator(500, true)
+//     defer it.Close()
+//     for it.Next() {
+//         fmt.Println(string(it.Row()))
+//     }
+//     if err := it.Err(); err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+type SearchIterator struct {
+	fetch    func(start, rows int) (io.ReadCloser, error)
+	pageSize int
+	prefetch bool
+	partial  bool
+
+	start    int
+	total    int
+	page     *searchPage
+	pageRows int
+	next     chan fetchedPage
+	row      json.RawMessage
+	err      error
+	done     bool
+}
+
+// fetchedPage is the outcome of a page request made ahead of time
+type fetchedPage struct {
+	body io.ReadCloser
+	err  error
+}
+
+// chef.Iterator returns an iterator over all the results of the search,
+// requested pageSize rows at a time, DefaultSearchPageSize if pageSize is 0.
+// The search's Start is where the iteration begins, and its Rows is ignored.
+// With prefetch, the next page is requested while the current one is being
+// read. Setting a Sort on the search is recommended, so that pages are cut
+// consistently.
+func (search *SearchParams) Iterator(pageSize int, prefetch bool) *SearchIterator {
+	endpoint := fmt.Sprintf("search/%s", search.Index)
+	return search.newIterator(pageSize, prefetch, false, func(params map[string]string) (io.ReadCloser, error) {
+		resp, err := search.chef.GetWithParams(endpoint, params)
+		if err != nil {
+			return nil, err
+		}
+		return streamedResponseBody(resp)
+	})
+}
+
+// chef.PartialIterator is like chef.Iterator, but runs a partial search, see
+// chef.ExecutePartial. Each row is a JSON object with the given keys.
+func (search *SearchParams) PartialIterator(keys PartialSearchKeys, pageSize int, prefetch bool) *SearchIterator {
+	endpoint := fmt.Sprintf("search/%s", search.Index)
+	payload, err := json.Marshal(keys)
+	if err == nil && len(keys) == 0 {
+		err = errors.New("a partial search needs at least one key")
+	}
+	it := search.newIterator(pageSize, prefetch, true, func(params map[string]string) (io.ReadCloser, error) {
+		resp, err := search.chef.Post(endpoint, "application/json", params, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		return streamedResponseBody(resp)
+	})
+	it.err = err
+	return it
+}
+
+// newIterator returns an iterator over the search, whose pages are requested
+// with the given function
+func (search *SearchParams) newIterator(pageSize int, prefetch, partial bool, request func(map[string]string) (io.ReadCloser, error)) *SearchIterator {
+	if pageSize <= 0 {
+		pageSize = DefaultSearchPageSize
+	}
+	start := search.Start
+	if start < 0 {
+		start = 0
+	}
+	query := *search
+	return &SearchIterator{
+		fetch: func(start, rows int) (io.ReadCloser, error) {
+			params := query.queryParams()
+			params["start"] = strconv.Itoa(start)
+			params["rows"] = strconv.Itoa(rows)
+			return request(params)
+		},
+		pageSize: pageSize,
+		prefetch: prefetch,
+		partial:  partial,
+		start:    start,
+		total:    -1,
+	}
+}
+
+// Next advances the iterator to the next row, which is then available through
+// Row. It returns false when there are no more rows or when an error
+// occurred, which Err then returns.
+func (it *SearchIterator) Next() bool {
+	for {
+		if it.err != nil || it.done {
+			it.row = nil
+			return false
+		}
+		if it.page == nil {
+			if err := it.openPage(); err != nil {
+				it.fail(err)
+				continue
+			}
+		}
+
+		row, ok, err := it.page.nextRow()
+		if err != nil {
+			it.fail(err)
+			continue
+		}
+		if ok {
+			it.row = row
+			it.pageRows++
+			return true
+		}
+
+		// the page is over
+		if err := it.checkPage(); err != nil {
+			it.fail(err)
+			continue
+		}
+		it.page.Close()
+		it.page = nil
+		it.start += it.pageRows
+		if it.start >= it.total {
+			it.Close()
+		}
+	}
+}
+
+// Row returns the current row
+func (it *SearchIterator) Row() json.RawMessage {
+	return it.row
+}
+
+// Total returns the total number of results of the search, as of the first
+// page, or -1 before the first page has been read
+func (it *SearchIterator) Total() int {
+	return it.total
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *SearchIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iteration and releases its connections. It's safe to call
+// it more than once, and after the iteration is over.
+func (it *SearchIterator) Close() error {
+	it.done = true
+	if it.page != nil {
+		it.page.Close()
+		it.page = nil
+	}
+	if it.next != nil {
+		next := it.next
+		it.next = nil
+		go func() {
+			if fetched := <-next; fetched.body != nil {
+				fetched.body.Close()
+			}
+		}()
+	}
+	return nil
+}
+
+// fail stops the iteration with an error
+func (it *SearchIterator) fail(err error) {
+	it.err = err
+	it.Close()
+}
+
+// openPage starts reading the page at it.start, prefetched or not, and
+// requests the following one if prefetching
+func (it *SearchIterator) openPage() error {
+	var body io.ReadCloser
+	var err error
+	if it.next != nil {
+		fetched := <-it.next
+		it.next = nil
+		body, err = fetched.body, fetched.err
+	} else {
+		body, err = it.fetch(it.start, it.pageSize)
+	}
+	if err != nil {
+		return err
+	}
+
+	it.page = newSearchPage(body, it.partial)
+	it.pageRows = 0
+	if err := it.page.readHeader(); err != nil {
+		return err
+	}
+	if it.page.start >= 0 && it.page.start != it.start {
+		return ErrSearchResultsChanged
+	}
+	if it.page.total >= 0 {
+		if it.total < 0 {
+			it.total = it.page.total
+		} else if it.page.total != it.total {
+			return ErrSearchResultsChanged
+		}
+	}
+
+	if it.prefetch && it.total >= 0 && it.start+it.pageSize < it.total {
+		next := make(chan fetchedPage, 1)
+		it.next = next
+		go func(start int) {
+			body, err := it.fetch(start, it.pageSize)
+			next <- fetchedPage{body, err}
+		}(it.start + it.pageSize)
+	}
+	return nil
+}
+
+// checkPage checks a page which has been read completely against the others
+func (it *SearchIterator) checkPage() error {
+	if it.page.total < 0 {
+		return errors.New("search results have no total")
+	}
+	if it.total < 0 {
+		it.total = it.page.total
+	} else if it.page.total != it.total {
+		return ErrSearchResultsChanged
+	}
+	// only the last page may be short
+	remaining := it.total - it.start
+	if remaining < 0 {
+		remaining = 0
+	}
+	if it.pageRows != it.pageSize && it.pageRows != remaining {
+		return ErrSearchResultsChanged
+	}
+	return nil
+}
+
+// searchPage streams the rows of a page of search results
+type searchPage struct {
+	body    io.ReadCloser
+	decoder *json.Decoder
+	total   int
+	start   int
+	partial bool
+	// whether the decoder is inside the rows array, and whether the
+	// whole page has been read
+	inRows bool
+	done   bool
+}
+
+func newSearchPage(body io.ReadCloser, partial bool) *searchPage {
+	return &searchPage{body: body, decoder: json.NewDecoder(body), total: -1, start: -1, partial: partial}
+}
+
+// readHeader reads the page up to its first row, or to its end if it has no
+// rows
+func (page *searchPage) readHeader() error {
+	token, err := page.decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('{') {
+		return errors.New("search results aren't a JSON object")
+	}
+	return page.readFields()
+}
+
+// readFields reads the fields of the page until the rows array or the end of
+// the page
+func (page *searchPage) readFields() error {
+	for page.decoder.More() {
+		token, err := page.decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case "total":
+			err = page.decoder.Decode(&page.total)
+		case "start":
+			err = page.decoder.Decode(&page.start)
+		case "rows":
+			token, err = page.decoder.Token()
+			if err == nil && token != json.Delim('[') {
+				err = errors.New("search result rows aren't a JSON array")
+			}
+			if err == nil {
+				page.inRows = true
+				return nil
+			}
+		default:
+			var skipped json.RawMessage
+			err = page.decoder.Decode(&skipped)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := page.decoder.Token(); err != nil {
+		return err
+	}
+	page.done = true
+	return nil
+}
+
+// nextRow decodes the next row of the page, and returns false once the page
+// is over. The rows of partial search results, {"url": ..., "data": {...}}
+// objects, are replaced with their data.
+func (page *searchPage) nextRow() (json.RawMessage, bool, error) {
+	for !page.done {
+		if page.inRows {
+			if page.decoder.More() {
+				var row json.RawMessage
+				if err := page.decoder.Decode(&row); err != nil {
+					return nil, false, err
+				}
+				if page.partial {
+					var partial struct {
+						Data json.RawMessage `json:"data"`
+					}
+					if err := json.Unmarshal(row, &partial); err != nil {
+						return nil, false, err
+					}
+					row = partial.Data
+				}
+				return row, true, nil
+			}
+			if _, err := page.decoder.Token(); err != nil {
+				return nil, false, err
+			}
+			page.inRows = false
+		}
+		if err := page.readFields(); err != nil {
+			return nil, false, err
+		}
+	}
+	return nil, false, nil
+}
+
+func (page *searchPage) Close() error {
+	return page.body.Close()
+}
+
+// streamedResponseBody returns the body of a successful response without
+// reading it, or the server's error like responseBody
+func streamedResponseBody(resp *http.Response) (io.ReadCloser, error) {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		_, err := responseBody(resp)
+		return nil, err
+	}
+	return resp.Body, nil
+}
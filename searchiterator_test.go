@@ -0,0 +1,130 @@
+package chef
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSearchPages serves pages of the given names as search results, calling
+// change before serving each page so that tests can modify the results
+type fakeSearchPages struct {
+	sync.Mutex
+	names    []string
+	partial  bool
+	requests int
+	change   func(request int, names []string) []string
+}
+
+func (f *fakeSearchPages) request(params map[string]string) (io.ReadCloser, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests++
+	if f.change != nil {
+		f.names = f.change(f.requests, f.names)
+	}
+	start, _ := strconv.Atoi(params["start"])
+	rows, _ := strconv.Atoi(params["rows"])
+	page := []interface{}{}
+	for i := start; i < start+rows && i < len(f.names); i++ {
+		row := map[string]interface{}{"name": f.names[i], "json_class": "Chef::Node"}
+		if f.partial {
+			page = append(page, map[string]interface{}{"url": "https://chef/nodes/" + f.names[i], "data": map[string]interface{}{"name": f.names[i]}})
+		} else {
+			page = append(page, row)
+		}
+	}
+	// rows come before total, as nothing guarantees the fields' order
+	body := fmt.Sprintf(`{"start": %d, "rows": %s, "total": %d}`, start, mustMarshal(page), len(f.names))
+	return ioutil.NopCloser(strings.NewReader(body)), nil
+}
+
+func mustMarshal(v interface{}) string {
+	encoded, _ := json.Marshal(v)
+	return string(encoded)
+}
+
+func iterateNames(it *SearchIterator) ([]string, error) {
+	defer it.Close()
+	names := []string{}
+	for it.Next() {
+		var row struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(it.Row(), &row); err != nil {
+			return names, err
+		}
+		names = append(names, row.Name)
+	}
+	return names, it.Err()
+}
+
+func TestSearchIterator(t *testing.T) {
+	for _, prefetch := range []bool{false, true} {
+		for _, partial := range []bool{false, true} {
+			pages := &fakeSearchPages{names: []string{"a", "b", "c", "d", "e", "f", "g"}, partial: partial}
+			search := (&Chef{}).NewSearchQuery("node", "*:*")
+			names, err := iterateNames(search.newIterator(3, prefetch, partial, pages.request))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(names, "") != "abcdefg" {
+				t.Errorf("unexpected rows %v", names)
+			}
+			if pages.requests != 3 {
+				t.Errorf("expected 3 requests, got %d", pages.requests)
+			}
+		}
+	}
+}
+
+func TestSearchIteratorStart(t *testing.T) {
+	pages := &fakeSearchPages{names: []string{"a", "b", "c", "d"}}
+	search := (&Chef{}).NewSearchQuery("node", "*:*")
+	search.Start = 1
+	names, err := iterateNames(search.newIterator(2, false, false, pages.request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, "") != "bcd" {
+		t.Errorf("unexpected rows %v", names)
+	}
+
+	pages = &fakeSearchPages{names: []string{}}
+	names, err = iterateNames((&Chef{}).NewSearchQuery("node", "*:*").newIterator(2, true, false, pages.request))
+	if err != nil || len(names) != 0 {
+		t.Errorf("unexpected rows %v, %v", names, err)
+	}
+}
+
+func TestSearchIteratorChanges(t *testing.T) {
+	changes := map[string]func(int, []string) []string{
+		"added": func(request int, names []string) []string {
+			if request == 2 {
+				return append(names, "z")
+			}
+			return names
+		},
+		"deleted": func(request int, names []string) []string {
+			if request == 3 {
+				return names[1:]
+			}
+			return names
+		},
+	}
+	for name, change := range changes {
+		for _, prefetch := range []bool{false, true} {
+			pages := &fakeSearchPages{names: []string{"a", "b", "c", "d", "e"}, change: change}
+			search := (&Chef{}).NewSearchQuery("node", "*:*")
+			_, err := iterateNames(search.newIterator(2, prefetch, false, pages.request))
+			if err != ErrSearchResultsChanged {
+				t.Errorf("%s, prefetch %v: expected ErrSearchResultsChanged, got %v", name, prefetch, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package chef
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultRequestSkew is the largest difference between a signed request's
+// timestamp and the local clock accepted by chef.VerifyRequest when none is
+// given, the same as the Chef server's
+const DefaultRequestSkew = 15 * time.Minute
+
+// ErrInvalidSignature is returned when a request or signature doesn't match
+// the public key it's checked against
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// chef.VerifyRequest checks that an incoming request was signed, the way Chef
+// clients sign their requests to the Chef server, with the private key
+// matching the given public key. Versions 1.0 and 1.1 of the signing protocol
+// are supported. The request body is read to check its hash and put back for
+// the handler to use. The request's timestamp must be within skew of the
+// local clock, DefaultRequestSkew if skew is 0.
+//
+// Usage:
+//
+//     func handler(w http.ResponseWriter, r *http.Request) {
+//         if err := chef.VerifyRequest(r, publicKey, 0); err != nil {
+//             http.Error(w, err.Error(), http.StatusUnauthorized)
+//             return
+//         }
+//         fmt.Fprintln(w, "hello", r.Header.Get("X-Ops-Userid"))
+//     }
+func VerifyRequest(request *http.Request, key *rsa.PublicKey, skew time.Duration) error {
+	canonical, err := canonicalRequest(request, skew)
+	if err != nil {
+		return err
+	}
+	signature, err := requestSignature(request)
+	if err != nil {
+		return err
+	}
+	// version 1.0 and 1.1 signatures are raw RSA_private_encrypt results,
+	// which is a PKCS#1 v1.5 signature of unhashed data
+	if err := rsa.VerifyPKCS1v15(key, crypto.Hash(0), []byte(canonical), signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// chef.AuthenticateRequest checks that an incoming request was signed by the
+// client or user it claims to come from, looking its public key up on the
+// Chef server, and returns that principal. Other than looking up the key, it
+// works like chef.VerifyRequest. Nodes can use it to authenticate to any HTTP
+// service with their Chef client key.
+//
+// Only members of the organization are accepted. If types are given, such as
+// "client", only principals of one of those types are.
+//
+// Usage:
+//
+//     func handler(w http.ResponseWriter, r *http.Request) {
+//         principal, err := c.AuthenticateRequest(r, 0, "client")
+//         if err != nil {
+//             http.Error(w, err.Error(), http.StatusUnauthorized)
+//             return
+//         }
+//         fmt.Fprintln(w, "hello", principal.Name)
+//     }
+func (chef *Chef) AuthenticateRequest(request *http.Request, skew time.Duration, types ...string) (*Principal, error) {
+	name := request.Header.Get("X-Ops-Userid")
+	if name == "" {
+		return nil, errors.New("missing X-Ops-UserId header")
+	}
+	// check what can be checked before asking the server
+	if _, err := canonicalRequest(request, skew); err != nil {
+		return nil, err
+	}
+	return chef.verifyPrincipal(name, types, func(key *rsa.PublicKey) error {
+		return VerifyRequest(request, key, skew)
+	})
+}
+
+// chef.Sign returns a detached signature of the given data made with the
+// connection's private key, RSA PKCS#1 v1.5 over its SHA-256 hash, which can
+// be checked with chef.VerifySignature or chef.VerifyPrincipalSignature.
+//
+// Usage:
+//
+//     signature, err := chef.Sign(payload)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) Sign(data []byte) ([]byte, error) {
+	hashed := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, chef.Key, crypto.SHA256, hashed[:])
+}
+
+// chef.VerifySignature checks a detached signature made by chef.Sign against
+// the given public key.
+func VerifySignature(key *rsa.PublicKey, data, signature []byte) error {
+	hashed := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// chef.VerifyPrincipalSignature checks a detached signature made by chef.Sign
+// against the public key of the principal with the given name, and returns
+// that principal. Like chef.AuthenticateRequest, it only accepts members of the
+// organization, of one of the given types if any.
+//
+// Usage:
+//
+//     principal, err := chef.VerifyPrincipalSignature("web1.example.com", payload, signature, "client")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println("signed by", principal.Type, principal.Name)
+func (chef *Chef) VerifyPrincipalSignature(name string, data, signature []byte, types ...string) (*Principal, error) {
+	return chef.verifyPrincipal(name, types, func(key *rsa.PublicKey) error {
+		return VerifySignature(key, data, signature)
+	})
+}
+
+// verifyPrincipal runs the given check against the public key of every
+// principal with the given name, and returns the first one it succeeds for
+func (chef *Chef) verifyPrincipal(name string, types []string, verify func(*rsa.PublicKey) error) (*Principal, error) {
+	principals, ok, err := chef.GetPrincipals(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("principal %s not found", name)
+	}
+	return verifyPrincipals(principals, types, verify)
+}
+
+// verifyPrincipals runs the given check against the public key of each
+// principal which is a member of the organization and of one of the given
+// types, if any, and returns the first one it succeeds for
+func verifyPrincipals(principals []Principal, types []string, verify func(*rsa.PublicKey) error) (*Principal, error) {
+	for i := range principals {
+		if !acceptedPrincipal(&principals[i], types) {
+			continue
+		}
+		key, err := principals[i].RSAPublicKey()
+		if err != nil {
+			continue
+		}
+		if verify(key) == nil {
+			return &principals[i], nil
+		}
+	}
+	return nil, ErrInvalidSignature
+}
+
+// acceptedPrincipal returns whether a principal is a member of the
+// organization and of one of the given types, if any
+func acceptedPrincipal(principal *Principal, types []string) bool {
+	if !principal.OrgMember {
+		return false
+	}
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if principal.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalRequest checks the timestamp and body hash of a signed request and
+// returns the string its signature covers
+func canonicalRequest(request *http.Request, skew time.Duration) (string, error) {
+	header := request.Header
+	for _, name := range []string{"X-Ops-Sign", "X-Ops-Userid", "X-Ops-Timestamp", "X-Ops-Content-Hash"} {
+		if header.Get(name) == "" {
+			return "", fmt.Errorf("missing %s header", name)
+		}
+	}
+
+	version := ""
+	for _, field := range strings.Split(header.Get("X-Ops-Sign"), ";") {
+		field = strings.TrimSpace(field)
+		if strings.HasPrefix(field, "version=") {
+			version = strings.TrimPrefix(field, "version=")
+		}
+	}
+	userID := header.Get("X-Ops-Userid")
+	switch version {
+	case "1.0":
+	case "1.1":
+		userID = hashStr(userID)
+	default:
+		return "", fmt.Errorf("unsupported signing protocol version '%s'", version)
+	}
+
+	if skew == 0 {
+		skew = DefaultRequestSkew
+	}
+	timestamp, err := time.Parse(time.RFC3339, header.Get("X-Ops-Timestamp"))
+	if err != nil {
+		return "", fmt.Errorf("invalid X-Ops-Timestamp header: %s", err)
+	}
+	if difference := time.Since(timestamp); difference > skew || difference < -skew {
+		return "", errors.New("request timestamp is too far from the local clock")
+	}
+
+	var body []byte
+	if request.Body != nil {
+		body, err = ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if hashStr(string(body)) != header.Get("X-Ops-Content-Hash") {
+		return "", errors.New("X-Ops-Content-Hash header doesn't match the body")
+	}
+
+	content := fmt.Sprintf("Method:%s\n", strings.ToUpper(request.Method))
+	content += fmt.Sprintf("Hashed Path:%s\n", hashStr(path.Clean(request.URL.Path)))
+	content += fmt.Sprintf("X-Ops-Content-Hash:%s\n", header.Get("X-Ops-Content-Hash"))
+	content += fmt.Sprintf("X-Ops-Timestamp:%s\n", header.Get("X-Ops-Timestamp"))
+	content += fmt.Sprintf("X-Ops-UserId:%s", userID)
+	return content, nil
+}
+
+// requestSignature joins and decodes the X-Ops-Authorization-N headers of a
+// signed request
+func requestSignature(request *http.Request) ([]byte, error) {
+	var encoded string
+	for i := 1; ; i++ {
+		line := request.Header.Get(fmt.Sprintf("X-Ops-Authorization-%d", i))
+		if line == "" {
+			break
+		}
+		encoded += line
+	}
+	if encoded == "" {
+		return nil, errors.New("missing X-Ops-Authorization headers")
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	return signature, nil
+}
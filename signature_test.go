@@ -0,0 +1,144 @@
+package chef
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func testSigningConnection(t *testing.T) *Chef {
+	key, err := keyFromFile("test/support/keys/admin.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Chef{Url: "https://chef.example.com", UserId: "admin", Key: key, Version: "11.6.0"}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	chef := testSigningConnection(t)
+	body := []byte(`{"name": "web1"}`)
+	request, _ := http.NewRequest("POST", chef.requestUrl("clients"), bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if err := chef.apiRequestHeaders(request); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyRequest(request, &chef.Key.PublicKey, 0); err != nil {
+		t.Fatal(err)
+	}
+	read, _ := ioutil.ReadAll(request.Body)
+	if !bytes.Equal(read, body) {
+		t.Error("the request body should be left for the handler")
+	}
+
+	other, err := keyFromFile("test/support/keys/chef-validator.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := VerifyRequest(request, &other.PublicKey, 0); err != ErrInvalidSignature {
+		t.Errorf("a request checked against another key should be invalid, got %v", err)
+	}
+
+	request.Body = ioutil.NopCloser(bytes.NewReader([]byte(`{"name": "web2"}`)))
+	if err := VerifyRequest(request, &chef.Key.PublicKey, 0); err == nil {
+		t.Error("a request with a modified body should be invalid")
+	}
+
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	request.Header.Set("X-Ops-Timestamp", time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+	if err := VerifyRequest(request, &chef.Key.PublicKey, 0); err == nil {
+		t.Error("an old request should be invalid")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	chef := testSigningConnection(t)
+	data := []byte("deploy web1")
+	signature, err := chef.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySignature(&chef.Key.PublicKey, data, signature); err != nil {
+		t.Error(err)
+	}
+	if err := VerifySignature(&chef.Key.PublicKey, []byte("deploy web2"), signature); err != ErrInvalidSignature {
+		t.Error("a signature of other data should be invalid")
+	}
+}
+
+func TestVerifyPrincipalSignature(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	config := testConfig()
+	data := []byte("deploy web1")
+	signature, err := chef.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err := chef.VerifyPrincipalSignature(config.RequiredPrincipal.Name, data, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Name != config.RequiredPrincipal.Name {
+		t.Errorf("unexpected principal %v", principal)
+	}
+}
+
+func TestVerifyPrincipals(t *testing.T) {
+	client, err := keyFromFile("test/support/keys/admin.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := keyFromFile("test/support/keys/chef-validator.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := func(key *rsa.PrivateKey) string {
+		der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		encoded, _ := json.Marshal(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+		return string(encoded)
+	}
+	// a client and a user outside the organization sharing its name
+	v1 := `{"principals": [
+		{"name": "web1", "type": "client", "public_key": ` + publicKey(client) + `, "org_member": true},
+		{"name": "web1", "type": "user", "public_key": ` + publicKey(user) + `, "org_member": false}
+	]}`
+	principals, err := parsePrincipals([]byte(v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("deploy web1")
+	signedBy := func(key *rsa.PrivateKey) func(*rsa.PublicKey) error {
+		signature, err := (&Chef{Key: key}).Sign(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return func(publicKey *rsa.PublicKey) error {
+			return VerifySignature(publicKey, data, signature)
+		}
+	}
+
+	principal, err := verifyPrincipals(principals, nil, signedBy(client))
+	if err != nil || principal.Type != "client" {
+		t.Errorf("the client's signature should be accepted, got %v, %v", principal, err)
+	}
+	if _, err := verifyPrincipals(principals, nil, signedBy(user)); err != ErrInvalidSignature {
+		t.Errorf("a user outside the organization should be refused, got %v", err)
+	}
+
+	principals[1].OrgMember = true
+	if _, err := verifyPrincipals(principals, []string{"client"}, signedBy(user)); err != ErrInvalidSignature {
+		t.Errorf("a user should be refused when only clients are, got %v", err)
+	}
+	principal, err = verifyPrincipals(principals, []string{"client", "user"}, signedBy(user))
+	if err != nil || principal.Type != "user" {
+		t.Errorf("the member user's signature should be accepted, got %v, %v", principal, err)
+	}
+}
@@ -0,0 +1,34 @@
+#!/bin/bash
+#
+# This script should only be used if you need to regen the encrypted data bag
+# items the decryption tests read, one per format version.
+#
+#  requires ruby and the chef gem, so that the items are encrypted by Chef
+#  itself and not by the code under test. The ruby and chef versions used are
+#  written to encrypted_data_bag/VERSIONS.
+#
+#-------------------------------------------------------------------------------
+pushd $(dirname "${0}") > /dev/null
+basedir=$(pwd -L)
+# Use "pwd -P" for the path without links. man bash for more info.
+popd > /dev/null
+
+set -x
+set -e
+
+cd $basedir/encrypted_data_bag
+
+ruby -rjson -rchef/version -rchef/encrypted_data_bag_item -e '
+  secret = Chef::EncryptedDataBagItem.load_secret("secret")
+  item = {
+    "id" => "mysql",
+    "password" => "s3cr3t",
+    "database" => { "user" => "root", "port" => 3306 },
+  }
+  [1, 2, 3].each do |version|
+    Chef::Config[:data_bag_encrypt_version] = version
+    encrypted = Chef::EncryptedDataBagItem.encrypt_data_bag_item(item, secret)
+    File.write("mysql_v#{version}.json", JSON.pretty_generate(encrypted) + "\n")
+  end
+  File.write("VERSIONS", "ruby #{RUBY_VERSION}\nchef #{Chef::VERSION}\n")
+'
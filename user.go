@@ -1,9 +1,27 @@
 package chef
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
 )
 
+// chef.User defines the relevant parameters of a Chef user. Password is only
+// sent to the server, when creating a user or changing its password, and is
+// never returned by it.
+type User struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	FirstName   string `json:"first_name"`
+	MiddleName  string `json:"middle_name"`
+	LastName    string `json:"last_name"`
+	PublicKey   string `json:"public_key"`
+	Password    string `json:"password,omitempty"`
+}
+
 // chef.GetUsers returns a map of user names to the users RESTful URL as well
 // as an error indicating if the request was successful or not.
 //
@@ -20,7 +38,7 @@ import (
 //         fmt.Println(user)
 //      }
 func (chef *Chef) GetUsers() (map[string]string, error) {
-	resp, err := chef.Get("users")
+	resp, err := chef.server().Get("users")
 	if err != nil {
 		return nil, err
 	}
@@ -34,3 +52,227 @@ func (chef *Chef) GetUsers() (map[string]string, error) {
 
 	return users, nil
 }
+
+// chef.GetUser returns the user with the given name, a bool indicating
+// whether or not the user was found and an error indicating if the request
+// failed or not. Users aren't part of an organization, they are read from the
+// root of the Chef server.
+//
+// Usage:
+//
+//     user, ok, err := chef.GetUser("jdoe")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     if !ok {
+//         fmt.Println("Couldn't find that user!")
+//     } else {
+//         fmt.Println(user.DisplayName, user.Email)
+//     }
+func (chef *Chef) GetUser(name string) (*User, bool, error) {
+	resp, err := chef.server().Get(fmt.Sprintf("users/%s", name))
+	if err != nil {
+		return nil, false, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		if hasStatus(err, http.StatusNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	user := new(User)
+	if err := json.Unmarshal(body, user); err != nil {
+		return nil, false, err
+	}
+	// older servers call it name
+	if user.Username == "" {
+		var named struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(body, &named)
+		user.Username = named.Name
+	}
+	return user, true, nil
+}
+
+// userNameRegexp matches the user names the Chef server accepts
+var userNameRegexp = regexp.MustCompile(`^[a-z0-9\-_]+$`)
+
+// userFields returns the fields of a user the server accepts when creating or
+// updating it
+func userFields(user *User) (map[string]interface{}, error) {
+	if !userNameRegexp.MatchString(user.Username) {
+		return nil, fmt.Errorf("invalid user name '%s'", user.Username)
+	}
+	fields := map[string]interface{}{
+		"username":     user.Username,
+		"name":         user.Username,
+		"display_name": user.DisplayName,
+		"email":        user.Email,
+		"first_name":   user.FirstName,
+		"middle_name":  user.MiddleName,
+		"last_name":    user.LastName,
+	}
+	if user.Password != "" {
+		fields["password"] = user.Password
+	}
+	return fields, nil
+}
+
+// chef.CreateUser creates a new user on the server from the supplied
+// *chef.User type. If the user has a PublicKey, that key is registered for
+// it, otherwise the server generates a key pair and its private key is
+// returned; it isn't kept by the server and must be saved right away.
+//
+// Usage:
+//
+//     privateKey, err := chef.CreateUser(&chef.User{
+//         Username:    "jdoe",
+//         DisplayName: "John Doe",
+//         Email:       "jdoe@example.com",
+//         FirstName:   "John",
+//         LastName:    "Doe",
+//         Password:    password,
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) CreateUser(user *User) (string, error) {
+	fields, err := userFields(user)
+	if err != nil {
+		return "", err
+	}
+	if user.PublicKey != "" {
+		fields["public_key"] = user.PublicKey
+	} else {
+		fields["create_key"] = true
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	resp, err := chef.server().Post("users", "application/json", nil, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return "", err
+	}
+	credentials, err := parseClientCredentials(user.Username, body)
+	if err != nil {
+		return "", err
+	}
+	return credentials.PrivateKey, nil
+}
+
+// chef.UpdateUser reads the user with the given name, hands it to the supplied
+// function to be modified, and writes the result back to the server. Setting
+// its Password changes the user's password, use chef.UpdateUserKey to change
+// its keys. The updated user is returned. If the function returns an error,
+// nothing is written.
+//
+// Usage:
+//
+//     user, err := chef.UpdateUser("jdoe", func(user *chef.User) error {
+//         user.Email = "john.doe@example.com"
+//         return nil
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) UpdateUser(name string, update func(*User) error) (*User, error) {
+	user, ok, err := chef.GetUser(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("user %s not found", name)
+	}
+	if err := update(user); err != nil {
+		return nil, err
+	}
+
+	fields, err := userFields(user)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chef.server().Put(fmt.Sprintf("users/%s", name), nil, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := responseBody(resp); err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// chef.DeleteUser deletes the user with the given name from the server.
+//
+// Usage:
+//
+//     err := chef.DeleteUser("jdoe")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) DeleteUser(name string) error {
+	resp, err := chef.server().Delete(fmt.Sprintf("users/%s", name), nil)
+	if err != nil {
+		return err
+	}
+	_, err = responseBody(resp)
+	return err
+}
+
+// chef.AuthenticateUser checks a user's password with the server. It returns
+// whether or not the password is right, and an error if the request failed.
+// Only superusers, such as the pivotal user, may call it.
+//
+// Usage:
+//
+//     ok, err := chef.AuthenticateUser("jdoe", password)
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     if !ok {
+//         fmt.Println("Wrong user name or password")
+//     }
+func (chef *Chef) AuthenticateUser(name, password string) (bool, error) {
+	payload, err := json.Marshal(map[string]string{"username": name, "password": password})
+	if err != nil {
+		return false, err
+	}
+	resp, err := chef.server().Post("authenticate_user", "application/json", nil, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		if hasStatus(err, http.StatusUnauthorized) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// older servers answer with a verified flag
+	var response struct {
+		Status   string `json:"status"`
+		Verified bool   `json:"verified"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return false, err
+	}
+	return response.Status == "linked" || response.Verified, nil
+}
@@ -1,6 +1,7 @@
 package chef
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -22,3 +23,71 @@ func TestGetUsers(t *testing.T) {
 		t.Error("Couldn't find required user")
 	}
 }
+
+func TestUserFields(t *testing.T) {
+	fields, err := userFields(&User{Username: "jdoe", Email: "jdoe@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["name"] != "jdoe" || fields["email"] != "jdoe@example.com" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if _, ok := fields["password"]; ok {
+		t.Error("an empty password shouldn't be sent")
+	}
+	for _, name := range []string{"", "John Doe", "JDoe"} {
+		if _, err := userFields(&User{Username: name}); err == nil {
+			t.Errorf("%s should be invalid", name)
+		}
+	}
+}
+
+func TestUserCRUD(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	name := "chef_golang_test"
+
+	privateKey, err := chef.CreateUser(&User{
+		Username:    name,
+		DisplayName: "Chef Golang",
+		Email:       "chef_golang_test@example.com",
+		FirstName:   "Chef",
+		LastName:    "Golang",
+		Password:    "s3cr3t-passw0rd",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chef.DeleteUser(name)
+	if !strings.Contains(privateKey, "PRIVATE KEY") {
+		t.Error("Creating a user should return its private key")
+	}
+
+	if ok, err := chef.AuthenticateUser(name, "s3cr3t-passw0rd"); err != nil || !ok {
+		t.Error("Couldn't authenticate the user", err)
+	}
+	if ok, _ := chef.AuthenticateUser(name, "wrong"); ok {
+		t.Error("A wrong password shouldn't authenticate the user")
+	}
+
+	_, err = chef.UpdateUser(name, func(user *User) error {
+		user.DisplayName = "Chef Go"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, ok, err := chef.GetUser(name)
+	if err != nil || !ok {
+		t.Fatal("Couldn't find updated user", err)
+	}
+	if user.DisplayName != "Chef Go" || user.Email != "chef_golang_test@example.com" {
+		t.Errorf("User wasn't updated: %v", user)
+	}
+
+	if err := chef.DeleteUser(name); err != nil {
+		t.Error(err)
+	}
+	if _, ok, _ := chef.GetUser(name); ok {
+		t.Error("User wasn't deleted")
+	}
+}
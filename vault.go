@@ -0,0 +1,538 @@
+package chef
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// chef.VaultKeys represents the "<item>_keys" companion item of a chef-vault
+// item. The vault item is an encrypted data bag item whose secret is random
+// and, for each admin and client allowed to read the item, encrypted with
+// their public key. Keys maps those actors to their encrypted copy of the
+// secret, base64 encoded.
+//
+// ExplicitClients are the clients which were given rather than found with the
+// search query. Items created by chef-vault don't record them, it's nil then.
+type VaultKeys struct {
+	ID              string
+	Admins          []string
+	Clients         []string
+	ExplicitClients []string
+	SearchQuery     string
+	Mode            string
+	Keys            map[string]string
+}
+
+// chef.VaultOptions define who can read a vault item. Admins are users,
+// Clients are API clients and, when SearchQuery is set, the clients of the
+// nodes it matches are added to them. Version is the encrypted data bag
+// format version used for the item, 3 if not set.
+type VaultOptions struct {
+	Admins      []string
+	Clients     []string
+	SearchQuery string
+	Version     int
+}
+
+// vaultKeysFields lists the fields of a keys item which aren't actors
+var vaultKeysFields = map[string]bool{
+	"id":               true,
+	"admins":           true,
+	"clients":          true,
+	"explicit_clients": true,
+	"search_query":     true,
+	"mode":             true,
+	"chef_type":        true,
+	"data_bag":         true,
+	"json_class":       true,
+}
+
+// UnmarshalJSON decodes a keys item, where the actors' keys sit alongside the
+// other fields
+func (keys *VaultKeys) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*keys = VaultKeys{Mode: "default", Keys: map[string]string{}}
+	json.Unmarshal(raw["id"], &keys.ID)
+	json.Unmarshal(raw["admins"], &keys.Admins)
+	json.Unmarshal(raw["clients"], &keys.Clients)
+	json.Unmarshal(raw["mode"], &keys.Mode)
+	if explicit, ok := raw["explicit_clients"]; ok {
+		keys.ExplicitClients = []string{}
+		json.Unmarshal(explicit, &keys.ExplicitClients)
+	}
+	// search_query is an empty array until a query is set
+	json.Unmarshal(raw["search_query"], &keys.SearchQuery)
+
+	for name, value := range raw {
+		if vaultKeysFields[name] {
+			continue
+		}
+		var key string
+		if err := json.Unmarshal(value, &key); err == nil {
+			keys.Keys[name] = key
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes a keys item the way chef-vault writes it
+func (keys *VaultKeys) MarshalJSON() ([]byte, error) {
+	item := map[string]interface{}{}
+	for name, key := range keys.Keys {
+		item[name] = key
+	}
+	item["id"] = keys.ID
+	item["admins"] = nonNilStrings(keys.Admins)
+	item["clients"] = nonNilStrings(keys.Clients)
+	if keys.ExplicitClients != nil {
+		item["explicit_clients"] = keys.ExplicitClients
+	}
+	item["mode"] = keys.Mode
+	if keys.SearchQuery == "" {
+		item["search_query"] = []string{}
+	} else {
+		item["search_query"] = keys.SearchQuery
+	}
+	return json.Marshal(item)
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// chef.GetVaultKeys returns the keys item of a vault item, a bool indicating
+// whether or not it was found and an error indicating if the request failed
+// or not.
+func (chef *Chef) GetVaultKeys(vault, id string) (*VaultKeys, bool, error) {
+	body, ok, err := chef.getDataBagItemJSON(vault, id+"_keys")
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	keys := new(VaultKeys)
+	if err := json.Unmarshal(body, keys); err != nil {
+		return nil, false, err
+	}
+	if keys.Mode != "default" {
+		return nil, false, fmt.Errorf("vault %s/%s uses the unsupported %s keys mode", vault, id, keys.Mode)
+	}
+	return keys, true, nil
+}
+
+// chef.GetVaultItem returns the decrypted vault item with the given id, a bool
+// indicating whether or not it was found and an error indicating if the
+// request or the decryption failed. The item's secret is decrypted with the
+// private key of the connection, which must be one of the item's admins or
+// clients.
+//
+// Usage:
+//
+//     item, ok, err := chef.GetVaultItem("passwords", "mysql")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     if ok {
+//         fmt.Println(item["root"])
+//     }
+func (chef *Chef) GetVaultItem(vault, id string) (DataBagItem, bool, error) {
+	keys, ok, err := chef.GetVaultKeys(vault, id)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	secret, err := chef.vaultSecret(vault, keys)
+	if err != nil {
+		return nil, false, err
+	}
+	return chef.GetEncryptedDataBagItem(vault, id, secret)
+}
+
+// vaultSecret decrypts the item's secret with the connection's private key
+func (chef *Chef) vaultSecret(vault string, keys *VaultKeys) ([]byte, error) {
+	encrypted, ok := keys.Keys[chef.UserId]
+	if !ok {
+		return nil, fmt.Errorf("%s isn't allowed to read vault item %s/%s", chef.UserId, vault, strings.TrimSuffix(keys.ID, "_keys"))
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.DecryptPKCS1v15(rand.Reader, chef.Key, data)
+}
+
+// chef.CreateVaultItem creates a vault item, and its keys item, readable by
+// the admins and clients of the options. The data bag is created if needed.
+// If the keys item can't be written, the vault item is deleted.
+//
+// Usage:
+//
+//     item := chef.DataBagItem{"id": "mysql", "root": "s3cr3t"}
+//     err := chef.CreateVaultItem("passwords", item, chef.VaultOptions{
+//         Admins:      []string{"alice"},
+//         SearchQuery: "role:database",
+//     })
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+func (chef *Chef) CreateVaultItem(vault string, item DataBagItem, options VaultOptions) error {
+	if err := validateDataBagItem(item); err != nil {
+		return err
+	}
+	keys := &VaultKeys{
+		ID:              item.ID() + "_keys",
+		Admins:          options.Admins,
+		Clients:         options.Clients,
+		ExplicitClients: mergeStrings(options.Clients),
+		SearchQuery:     options.SearchQuery,
+		Mode:            "default",
+	}
+	if keys.SearchQuery != "" {
+		matching, err := chef.vaultSearchClients(keys.SearchQuery)
+		if err != nil {
+			return err
+		}
+		keys.Clients = mergeStrings(keys.Clients, matching)
+	}
+	encrypted, keys, err := chef.encryptVaultItem(item, keys, options.Version)
+	if err != nil {
+		return err
+	}
+
+	if _, ok, err := chef.GetDataByName(vault); err != nil {
+		return err
+	} else if !ok {
+		if err := chef.CreateDataBag(vault); err != nil {
+			return err
+		}
+	}
+	if err := chef.CreateDataBagItem(vault, encrypted); err != nil {
+		return err
+	}
+	if err := chef.CreateDataBagItem(vault, keys.item()); err != nil {
+		// without its keys, nobody could decrypt the item
+		if deleteErr := chef.DeleteDataBagItem(vault, item.ID()); deleteErr != nil {
+			return fmt.Errorf("writing the keys of vault item %s/%s failed (%s) and deleting the item failed too, it can't be decrypted: %s", vault, item.ID(), err, deleteErr)
+		}
+		return fmt.Errorf("writing the keys of vault item %s/%s failed, the item was deleted: %s", vault, item.ID(), err)
+	}
+	return nil
+}
+
+// chef.UpdateVaultItem reads and decrypts the vault item with the given id,
+// hands it to the supplied function to be modified, and writes the result
+// back to the server, encrypted with the item's current secret. If the
+// function returns an error, nothing is written.
+//
+// Usage:
+//
+//     _, err := chef.UpdateVaultItem("passwords", "mysql", func(item chef.DataBagItem) error {
+//         item["root"] = "n3w s3cr3t"
+//         return nil
+//     })
+func (chef *Chef) UpdateVaultItem(vault, id string, update func(DataBagItem) error) (DataBagItem, error) {
+	keys, ok, err := chef.GetVaultKeys(vault, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("vault item %s/%s not found", vault, id)
+	}
+	secret, err := chef.vaultSecret(vault, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var item DataBagItem
+	_, err = chef.UpdateDataBagItem(vault, id, func(stored DataBagItem) error {
+		version, err := EncryptedDataBagItemVersion(stored)
+		if err != nil {
+			return err
+		}
+		if item, err = DecryptDataBagItem(stored, secret); err != nil {
+			return err
+		}
+		if err := update(item); err != nil {
+			return err
+		}
+		encrypted, err := EncryptDataBagItem(item, secret, version)
+		if err != nil {
+			return err
+		}
+		replaceDataBagItem(stored, encrypted)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// chef.RekeyVaultItem generates a new secret for a vault item, re-encrypts
+// the item with it and encrypts it for the item's current admins and
+// clients. When the item has a search query, it's run again: clients of new
+// matching nodes gain access and, if the item records its explicit clients,
+// those which no longer match lose it. Explicit clients keep their access, and
+// the given clients are added to them. Clients which no longer exist are
+// dropped. Run it when clients come and go, or when a client which had access
+// is compromised.
+//
+// The item is written before its keys. If writing the keys fails, the
+// previous item is put back, so it stays readable with the previous keys.
+//
+// Usage:
+//
+//     keys, err := chef.RekeyVaultItem("passwords", "mysql")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println(keys.Clients)
+func (chef *Chef) RekeyVaultItem(vault, id string, clients ...string) (*VaultKeys, error) {
+	keys, ok, err := chef.GetVaultKeys(vault, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("vault item %s/%s not found", vault, id)
+	}
+	secret, err := chef.vaultSecret(vault, keys)
+	if err != nil {
+		return nil, err
+	}
+	stored, ok, err := chef.GetDataBagItem(vault, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("vault item %s/%s not found", vault, id)
+	}
+	version, err := EncryptedDataBagItemVersion(stored)
+	if err != nil {
+		return nil, err
+	}
+	item, err := DecryptDataBagItem(stored, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := chef.GetClients()
+	if err != nil {
+		return nil, err
+	}
+	var matching []string
+	if keys.SearchQuery != "" {
+		if matching, err = chef.vaultSearchClients(keys.SearchQuery); err != nil {
+			return nil, err
+		}
+	}
+	rekeyVaultClients(keys, matching, existing, clients)
+
+	encrypted, keys, err := chef.encryptVaultItem(item, keys, version)
+	if err != nil {
+		return nil, err
+	}
+	_, err = chef.UpdateDataBagItem(vault, id, func(current DataBagItem) error {
+		replaceDataBagItem(current, encrypted)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = chef.UpdateDataBagItem(vault, keys.ID, func(current DataBagItem) error {
+		replaceDataBagItem(current, keys.item())
+		return nil
+	})
+	if err != nil {
+		_, restoreErr := chef.UpdateDataBagItem(vault, id, func(current DataBagItem) error {
+			replaceDataBagItem(current, stored)
+			return nil
+		})
+		if restoreErr != nil {
+			return nil, fmt.Errorf("writing the keys of vault item %s/%s failed (%s) and restoring the item failed too, it can't be decrypted: %s", vault, id, err, restoreErr)
+		}
+		return nil, fmt.Errorf("writing the keys of vault item %s/%s failed, the item was restored: %s", vault, id, err)
+	}
+	return keys, nil
+}
+
+// rekeyVaultClients sets the clients a vault item is rekeyed for: its
+// explicit clients, along with the extra ones, and those matching its search
+// query. When the explicit clients aren't known, all the current clients are
+// kept. Only the clients which exist are.
+func rekeyVaultClients(keys *VaultKeys, matching []string, existing map[string]string, extra []string) {
+	kept := func(clients []string) []string {
+		exist := []string{}
+		for _, client := range clients {
+			if _, ok := existing[client]; ok {
+				exist = append(exist, client)
+			}
+		}
+		return exist
+	}
+	explicit := keys.Clients
+	if keys.ExplicitClients != nil {
+		keys.ExplicitClients = kept(mergeStrings(keys.ExplicitClients, extra))
+		explicit = keys.ExplicitClients
+	}
+	keys.Clients = kept(mergeStrings(explicit, extra, matching))
+}
+
+// mergeStrings returns the sorted union of string slices
+func mergeStrings(slices ...[]string) []string {
+	merged := map[string]string{}
+	for _, slice := range slices {
+		for _, s := range slice {
+			merged[s] = s
+		}
+	}
+	return sortedKeys(merged)
+}
+
+// vaultSearchClients returns the names of the clients of the nodes matching a
+// vault item's search query
+func (chef *Chef) vaultSearchClients(query string) ([]string, error) {
+	clients := []string{}
+	err := chef.searchAll("node", query, func(row json.RawMessage) error {
+		var node struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(row, &node); err != nil {
+			return err
+		}
+		clients = append(clients, node.Name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// replaceDataBagItem replaces the content of an item with another's
+func replaceDataBagItem(item, with DataBagItem) {
+	for key := range item {
+		delete(item, key)
+	}
+	for key, value := range with {
+		item[key] = value
+	}
+}
+
+// encryptVaultItem encrypts an item with a new random secret, and the secret
+// for each admin and client
+func (chef *Chef) encryptVaultItem(item DataBagItem, keys *VaultKeys, version int) (DataBagItem, *VaultKeys, error) {
+	if version == 0 {
+		version = 3
+	}
+	if len(keys.Admins) == 0 && len(keys.Clients) == 0 {
+		return nil, nil, errors.New("a vault item needs at least one admin or client")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+	encrypted, err := EncryptDataBagItem(item, secret, version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys.Keys = map[string]string{}
+	actors := []struct {
+		names []string
+		admin bool
+	}{{keys.Admins, true}, {keys.Clients, false}}
+	for _, actor := range actors {
+		for _, name := range actor.names {
+			publicKey, err := chef.vaultPublicKey(name, actor.admin)
+			if err != nil {
+				return nil, nil, err
+			}
+			key, err := rsa.EncryptPKCS1v15(rand.Reader, publicKey, secret)
+			if err != nil {
+				return nil, nil, err
+			}
+			keys.Keys[name] = encode64(key)
+		}
+	}
+	return encrypted, keys, nil
+}
+
+// vaultPublicKey returns the public key of an admin, looked up as a
+// principal, or of a client
+func (chef *Chef) vaultPublicKey(name string, admin bool) (*rsa.PublicKey, error) {
+	if admin {
+		principal, ok, err := chef.GetPrincipal(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("admin %s not found", name)
+		}
+		return principal.RSAPublicKey()
+	}
+
+	client, ok, err := chef.GetClient(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("client %s not found", name)
+	}
+	if client.PublicKey != "" {
+		return parsePublicKey(client.PublicKey)
+	}
+	// Chef 11 servers only return the client's certificate
+	return parsePublicKey(client.Certificate)
+}
+
+// parsePublicKey parses an RSA public key in the PKIX, PKCS#1 or X.509
+// certificate PEM formats
+func parsePublicKey(key string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, errors.New("invalid public key")
+	}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if publicKey, ok := certificate.PublicKey.(*rsa.PublicKey); ok {
+			return publicKey, nil
+		}
+	default:
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if publicKey, ok := parsed.(*rsa.PublicKey); ok {
+			return publicKey, nil
+		}
+	}
+	return nil, errors.New("public key isn't an RSA key")
+}
+
+// item returns the keys as a data bag item
+func (keys *VaultKeys) item() DataBagItem {
+	data, _ := keys.MarshalJSON()
+	item := DataBagItem{}
+	json.Unmarshal(data, &item)
+	return item
+}
@@ -0,0 +1,168 @@
+package chef
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVaultKeysJSON(t *testing.T) {
+	data := `{
+		"id": "mysql_keys",
+		"admins": ["alice"],
+		"clients": ["db1"],
+		"search_query": [],
+		"mode": "default",
+		"alice": "YWxpY2U=\n",
+		"db1": "ZGIx\n"
+	}`
+	keys := new(VaultKeys)
+	if err := json.Unmarshal([]byte(data), keys); err != nil {
+		t.Fatal(err)
+	}
+	expected := &VaultKeys{
+		ID:      "mysql_keys",
+		Admins:  []string{"alice"},
+		Clients: []string{"db1"},
+		Mode:    "default",
+		Keys:    map[string]string{"alice": "YWxpY2U=\n", "db1": "ZGIx\n"},
+	}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("unexpected keys %#v", keys)
+	}
+
+	keys.SearchQuery = "role:database"
+	item := keys.item()
+	if item["search_query"] != "role:database" || item["alice"] != "YWxpY2U=\n" || item.ID() != "mysql_keys" {
+		t.Errorf("unexpected item %v", item)
+	}
+	if _, ok := item["explicit_clients"]; ok {
+		t.Error("unknown explicit clients shouldn't be written")
+	}
+
+	keys.ExplicitClients = []string{"db1"}
+	encoded, err := json.Marshal(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(encoded, keys); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys.ExplicitClients, []string{"db1"}) || keys.Keys["explicit_clients"] != "" {
+		t.Errorf("unexpected keys %#v", keys)
+	}
+}
+
+func TestVaultSecret(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the public key the way the server returns it, in each format
+	pkixKey, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "db1"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	encoded := []*pem.Block{
+		{Type: "PUBLIC KEY", Bytes: pkixKey},
+		{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)},
+		{Type: "CERTIFICATE", Bytes: certificate},
+	}
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	chef := &Chef{UserId: "db1", Key: key}
+	for _, block := range encoded {
+		publicKey, err := parsePublicKey(string(pem.EncodeToMemory(block)))
+		if err != nil {
+			t.Fatalf("%s: %s", block.Type, err)
+		}
+		encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, publicKey, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := &VaultKeys{ID: "mysql_keys", Keys: map[string]string{"db1": encode64(encrypted)}}
+		decrypted, err := chef.vaultSecret("passwords", keys)
+		if err != nil {
+			t.Fatalf("%s: %s", block.Type, err)
+		}
+		if string(decrypted) != string(secret) {
+			t.Errorf("%s: unexpected secret %q", block.Type, decrypted)
+		}
+	}
+
+	if _, err := (&Chef{UserId: "web1", Key: key}).vaultSecret("passwords", &VaultKeys{}); err == nil {
+		t.Error("actors without a key should be refused")
+	}
+}
+
+func TestVaultItemCRUD(t *testing.T) {
+	chef := testConnectionWrapper(t)
+	vault := "chef_golang_vault_test"
+	defer chef.DeleteDataBag(vault)
+
+	item := DataBagItem{"id": "mysql", "root": "s3cr3t"}
+	err := chef.CreateVaultItem(vault, item, VaultOptions{Admins: []string{chef.UserId}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = chef.UpdateVaultItem(vault, "mysql", func(item DataBagItem) error {
+		item["root"] = "n3w s3cr3t"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chef.RekeyVaultItem(vault, "mysql"); err != nil {
+		t.Fatal(err)
+	}
+
+	item, ok, err := chef.GetVaultItem(vault, "mysql")
+	if err != nil || !ok {
+		t.Fatal("Couldn't read vault item", err)
+	}
+	if item["root"] != "n3w s3cr3t" {
+		t.Errorf("unexpected vault item %v", item)
+	}
+}
+
+func TestRekeyVaultClients(t *testing.T) {
+	existing := map[string]string{"db1": "", "db2": "", "db3": "", "app": "", "backup": ""}
+
+	// with a search query, matching clients which no longer match lose
+	// access, but explicit ones keep it
+	keys := &VaultKeys{Clients: []string{"app", "db1", "db2"}, ExplicitClients: []string{"app"}, SearchQuery: "role:database"}
+	rekeyVaultClients(keys, []string{"db2", "db3"}, existing, []string{"backup"})
+	if !reflect.DeepEqual(keys.Clients, []string{"app", "backup", "db2", "db3"}) {
+		t.Errorf("unexpected clients %v", keys.Clients)
+	}
+	if !reflect.DeepEqual(keys.ExplicitClients, []string{"app", "backup"}) {
+		t.Errorf("unexpected explicit clients %v", keys.ExplicitClients)
+	}
+
+	// when the explicit clients aren't known, current clients are kept
+	keys = &VaultKeys{Clients: []string{"app", "db1"}, SearchQuery: "role:database"}
+	rekeyVaultClients(keys, []string{"db2"}, existing, nil)
+	if !reflect.DeepEqual(keys.Clients, []string{"app", "db1", "db2"}) || keys.ExplicitClients != nil {
+		t.Errorf("unexpected clients %v, %v", keys.Clients, keys.ExplicitClients)
+	}
+
+	// clients which no longer exist lose access
+	keys = &VaultKeys{Clients: []string{"db1", "deleted"}, ExplicitClients: []string{"db1", "deleted"}}
+	rekeyVaultClients(keys, nil, existing, nil)
+	if !reflect.DeepEqual(keys.Clients, []string{"db1"}) || !reflect.DeepEqual(keys.ExplicitClients, []string{"db1"}) {
+		t.Errorf("unexpected clients %v, %v", keys.Clients, keys.ExplicitClients)
+	}
+}
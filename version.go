@@ -0,0 +1,184 @@
+package chef
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// chef.Version represents a Chef cookbook version number. Chef versions are of
+// the form "x.y.z" or "x.y", where the latter is treated as "x.y.0".
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// chef.ParseVersion accepts a string which represents a cookbook version and
+// returns the corresponding chef.Version as well as an error indicating whether
+// or not the string was a valid Chef version.
+//
+// Usage:
+//
+//     version, err := chef.ParseVersion("1.10.2")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     fmt.Println(version.Major, version.Minor, version.Patch)
+func ParseVersion(s string) (Version, error) {
+	var version Version
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return version, fmt.Errorf("invalid cookbook version '%s'", s)
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || strings.HasPrefix(part, "+") {
+			return version, fmt.Errorf("invalid cookbook version '%s'", s)
+		}
+		numbers[i] = n
+	}
+	version.Major, version.Minor, version.Patch = numbers[0], numbers[1], numbers[2]
+	return version, nil
+}
+
+// String returns the "x.y.z" form of the version
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is lower than, equal to or
+// greater than other
+func (v Version) Compare(other Version) int {
+	switch {
+	case v.Major != other.Major:
+		return compareInts(v.Major, other.Major)
+	case v.Minor != other.Minor:
+		return compareInts(v.Minor, other.Minor)
+	default:
+		return compareInts(v.Patch, other.Patch)
+	}
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// chef.VersionConstraint represents a Chef cookbook version constraint such as
+// ">= 1.0.0" or "~> 2.1". The operators supported are the ones Chef supports:
+// "=", "!=", ">", "<", ">=", "<=" and "~>".
+type VersionConstraint struct {
+	Operator string
+	Version  Version
+	// the number of components in the original version string, which is
+	// needed to evaluate the pessimistic "~>" operator
+	components int
+}
+
+var constraintOperators = []string{">=", "<=", "~>", "!=", "=", ">", "<"}
+
+// chef.ParseVersionConstraint accepts a string which represents a cookbook
+// version constraint and returns a chef.VersionConstraint as well as an error
+// indicating whether or not the constraint was valid. A bare version such as
+// "1.0.0" is treated as "= 1.0.0" and an empty string as ">= 0.0.0".
+//
+// Usage:
+//
+//     constraint, err := chef.ParseVersionConstraint("~> 1.2")
+//     if err != nil {
+//         fmt.Println(err)
+//         os.Exit(1)
+//     }
+//     version, _ := chef.ParseVersion("1.9.0")
+//     fmt.Println(constraint.Satisfies(version)) // true
+func ParseVersionConstraint(s string) (VersionConstraint, error) {
+	constraint := VersionConstraint{Operator: ">=", components: 3}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return constraint, nil
+	}
+
+	constraint.Operator = "="
+	for _, op := range constraintOperators {
+		if strings.HasPrefix(s, op) {
+			constraint.Operator = op
+			s = strings.TrimSpace(strings.TrimPrefix(s, op))
+			break
+		}
+	}
+
+	version, err := ParseVersion(s)
+	if err != nil {
+		return constraint, fmt.Errorf("invalid version constraint: %s", err)
+	}
+	constraint.Version = version
+	constraint.components = len(strings.Split(s, "."))
+	return constraint, nil
+}
+
+// Satisfies returns true if the supplied version meets the constraint
+func (c VersionConstraint) Satisfies(v Version) bool {
+	cmp := v.Compare(c.Version)
+	switch c.Operator {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case "~>":
+		if cmp < 0 {
+			return false
+		}
+		// "~> x.y" allows anything below (x+1).0, "~> x.y.z" anything below
+		// x.(y+1).0
+		upper := Version{Major: c.Version.Major + 1}
+		if c.components == 3 {
+			upper = Version{Major: c.Version.Major, Minor: c.Version.Minor + 1}
+		}
+		return v.Compare(upper) < 0
+	}
+	return false
+}
+
+// String returns the constraint in the form Chef uses in cookbook metadata,
+// e.g. ">= 1.0.0"
+func (c VersionConstraint) String() string {
+	version := c.Version.String()
+	if c.components == 2 {
+		version = fmt.Sprintf("%d.%d", c.Version.Major, c.Version.Minor)
+	}
+	return fmt.Sprintf("%s %s", c.Operator, version)
+}
+
+// sortVersionsDescending sorts a slice of version strings from newest to
+// oldest, dropping the ones which can't be parsed
+func sortVersionsDescending(versions []string) []Version {
+	sorted := []Version{}
+	for _, s := range versions {
+		v, err := ParseVersion(s)
+		if err != nil {
+			continue
+		}
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Compare(sorted[j]) > 0
+	})
+	return sorted
+}
@@ -0,0 +1,67 @@
+package chef
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	known := map[string]string{
+		"1.10.2": "1.10.2",
+		"1.2":    "1.2.0",
+		" 0.0.1": "0.0.1",
+	}
+	for in, out := range known {
+		v, err := ParseVersion(in)
+		if err != nil {
+			t.Error(err)
+		}
+		if v.String() != out {
+			t.Errorf("ParseVersion(%q) = %s, expected %s", in, v, out)
+		}
+	}
+
+	for _, bad := range []string{"", "1", "1.2.3.4", "a.b.c", "1.-2.0"} {
+		if _, err := ParseVersion(bad); err == nil {
+			t.Errorf("ParseVersion(%q) should have failed", bad)
+		}
+	}
+}
+
+func TestVersionConstraintSatisfies(t *testing.T) {
+	known := []struct {
+		constraint string
+		version    string
+		ok         bool
+	}{
+		{"", "0.0.1", true},
+		{"1.0.0", "1.0.0", true},
+		{"= 1.0", "1.0.1", false},
+		{"!= 1.0.0", "1.0.0", false},
+		{">= 1.2.0", "1.10.0", true},
+		{"> 1.2.0", "1.2.0", false},
+		{"< 2.0", "1.99.99", true},
+		{"<= 2.0", "2.0.1", false},
+		{"~> 1.2", "1.9.0", true},
+		{"~> 1.2", "2.0.0", false},
+		{"~> 1.2.3", "1.2.9", true},
+		{"~> 1.2.3", "1.3.0", false},
+		{"~> 1.2.3", "1.2.2", false},
+	}
+	for _, k := range known {
+		c, err := ParseVersionConstraint(k.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := ParseVersion(k.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Satisfies(v) != k.ok {
+			t.Errorf("%q satisfies %q should be %v", k.version, k.constraint, k.ok)
+		}
+	}
+
+	if _, err := ParseVersionConstraint(">= banana"); err == nil {
+		t.Error("invalid constraint should have failed to parse")
+	}
+}